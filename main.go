@@ -0,0 +1,62 @@
+package main
+
+/*
+	Wgetpipe takes a list of fully-qualified URLs over STDIN and Gets them,
+	outputting the code, url and elapsed fetch time.
+
+	This is the command; the engine is the pkg/fetcher package, which can be
+	embedded in other programs
+*/
+
+import (
+	"github.com/cognusion/wgetpipe/pkg/fetcher"
+
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	var exit *fetcher.ExitError
+
+	f := fetcher.New()
+	if err := f.Configure(os.Args[1:]); errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	} else if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stream the signals we care about
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	// Signal handler
+	go func() {
+		for sig := range sigChan {
+			switch sig {
+			case syscall.SIGUSR1:
+				f.TogglePause()
+			case syscall.SIGUSR2:
+				f.ResizeFromFile()
+			default:
+				cancel()
+				return
+			}
+		}
+	}()
+
+	if err := f.Run(ctx); errors.As(err, &exit) {
+		os.Exit(exit.Code)
+	} else if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+}
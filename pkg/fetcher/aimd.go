@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"net/http"
+	"time"
+)
+
+// aimd adapts the number of getters to what the origin sustains, by additive
+// increase while healthy, and multiplicative decrease on congestion
+type aimd struct {
+	f     *Fetcher // Whose getters are resized
+	limit int      // Most getters to grow to
+
+	// The current window of results, as many as there are getters
+	n, bad int
+	total  time.Duration
+
+	best     time.Duration // Lowest mean latency of a window, as the healthy baseline
+	Min, Max int           // Fewest and most getters reached
+}
+
+// newAIMD returns an aimd growing f's getters to at most limit
+func newAIMD(f *Fetcher, limit int) *aimd {
+	return &aimd{f: f, limit: limit}
+}
+
+// congested returns true if the result is a sign of the origin being
+// overwhelmed: a non-HTTP error (e.g. a timeout), a 429, or a 5xx
+func congested(i *urlCode) bool {
+	return i.Code == 0 || i.Code == http.StatusTooManyRequests || i.Code >= 500
+}
+
+// add tallies the result, and after each window resizes the workers: halving
+// them if any results were congested, else adding one if the mean latency is
+// within twice the best seen
+func (a *aimd) add(i *urlCode) {
+	a.n++
+	if congested(i) {
+		a.bad++
+	} else {
+		a.total += i.Dur
+	}
+
+	pool := a.f.workers.Load()
+	size := pool.Size()
+	if a.n < size {
+		return
+	}
+	next := size
+	if a.bad > 0 {
+		next = size / 2
+		if next < 1 {
+			next = 1
+		}
+	} else {
+		mean := a.total / time.Duration(a.n)
+		if a.best == 0 || mean < a.best {
+			a.best = mean
+		}
+		if mean <= 2*a.best && size < a.limit {
+			next = size + 1
+		}
+	}
+	if next != size {
+		a.f.Logger.Debug("auto-max resizing getters", "congested", a.bad, "of", a.n, "from", size, "to", next)
+		pool.resize(next)
+	}
+	if a.Min == 0 || next < a.Min {
+		a.Min = next
+	}
+	if next > a.Max {
+		a.Max = next
+	}
+	a.n, a.bad, a.total = 0, 0, 0
+}
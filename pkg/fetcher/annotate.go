@@ -0,0 +1,155 @@
+package fetcher
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// annotationMap maps URLs (or URL prefixes) to annotation columns, from an
+// -annotate CSV file
+type annotationMap struct {
+	Columns  []string            // Annotation column names, in order
+	urls     map[string][]string // URL to column values
+	prefixes []string            // URLs, longest first, for prefix matching
+	carried  int                 // Trailing Columns carried through from -input csv or tsv rows, not looked up
+}
+
+// rollup holds the tallies of responses with an annotation value
+type rollup struct {
+	Count int // Responses
+	Bad   int // Responses that were errors, failures, mismatches, or 4xx/5xx
+}
+
+// loadAnnotations reads an -annotate CSV file, whose header row is "url" and
+// the annotation column names, and whose other rows are a URL (or URL prefix)
+// and its annotations
+func loadAnnotations(file string) (*annotationMap, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) < 2 {
+		return nil, fmt.Errorf("'%s' has no annotation columns", file)
+	}
+
+	a := &annotationMap{Columns: rows[0][1:], urls: make(map[string][]string)}
+	for _, row := range rows[1:] {
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		values := make([]string, len(a.Columns))
+		copy(values, row[1:])
+		a.urls[row[0]] = values
+		a.prefixes = append(a.prefixes, row[0])
+	}
+	sort.Slice(a.prefixes, func(i, j int) bool { return len(a.prefixes[i]) > len(a.prefixes[j]) })
+	return a, nil
+}
+
+// lookup returns the annotation values of the URL, by exact match, else by the
+// longest matching prefix, or nil if none match
+func (a *annotationMap) lookup(u string) []string {
+	if a == nil {
+		return nil
+	}
+	if v, ok := a.urls[u]; ok {
+		return v
+	}
+	for _, p := range a.prefixes {
+		if strings.HasPrefix(u, p) {
+			return a.urls[p]
+		}
+	}
+	return nil
+}
+
+// values returns the annotation values of the result: those of its URL, then
+// any carried through from its input row
+func (a *annotationMap) values(i *urlCode) []string {
+	v := a.lookup(i.URL)
+	if a.carried == 0 {
+		return v
+	}
+	values := make([]string, len(a.Columns))
+	copy(values, v)
+	copy(values[len(a.Columns)-a.carried:], i.Carried)
+	return values
+}
+
+// rolledUp returns the columns rolled up with -stats: all but those carried
+// through, whose values are rarely shared
+func (a *annotationMap) rolledUp() []string {
+	return a.Columns[:len(a.Columns)-a.carried]
+}
+
+// format returns the annotation values as "[column=value, ...]", or "" if
+// there are none
+func (a *annotationMap) format(values []string) string {
+	var s []string
+	for i, v := range values {
+		if v != "" {
+			s = append(s, a.Columns[i]+"="+v)
+		}
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+// annotate tallies the response into the rollups of its values of the
+// annotation columns
+func (s *stat) annotate(columns, values []string, ok bool) {
+	if s.Rollups == nil {
+		s.Rollups = make(map[string]map[string]*rollup)
+	}
+	for i, col := range columns {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		if s.Rollups[col] == nil {
+			s.Rollups[col] = make(map[string]*rollup)
+		}
+		r, exists := s.Rollups[col][v]
+		if !exists {
+			r = &rollup{}
+			s.Rollups[col][v] = r
+		}
+		r.Count++
+		if !ok {
+			r.Bad++
+		}
+	}
+}
+
+// printRollups outputs the tallies of each annotation column's values
+func (s *stat) printRollups(columns []string) {
+	for _, col := range columns {
+		fmt.Printf("By %s:\n", col)
+		values := make([]string, 0, len(s.Rollups[col]))
+		for v := range s.Rollups[col] {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		for _, v := range values {
+			r := s.Rollups[col][v]
+			name := v
+			if name == "" {
+				name = "(none)"
+			}
+			fmt.Printf("  %s: %d GETs, %d bad\n", name, r.Count, r.Bad)
+		}
+	}
+}
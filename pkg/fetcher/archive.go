@@ -0,0 +1,194 @@
+package fetcher
+
+import (
+	"github.com/klauspost/compress/zstd"
+
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveSaver is a saver into a single tar (optionally gzip or zstd
+// compressed) or zip archive, for -save-archive. Entries are named as
+// SaveFile names files, and are written as they're saved, so it must be
+// closed to be complete
+type archiveSaver struct {
+	lock  sync.Mutex
+	file  *os.File
+	comp  io.WriteCloser // The compressor between the tar and the file, if any
+	tar   *tar.Writer    // Either this
+	zip   *zip.Writer    // or this is written
+	saved map[string]bool
+	sync  bool         // Whether to fsync the file once finished
+	log   *slog.Logger // Where diagnostics are logged
+}
+
+// newArchiveSaver creates the archive file, whose format is that of its
+// extension: .tar, .tar.gz (or .tgz), .tar.zst, or .zip, to be fsynced once
+// finished if sync is set
+func newArchiveSaver(file string, sync bool, log *slog.Logger) (*archiveSaver, error) {
+	lower := strings.ToLower(file)
+	formats := []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".zip"}
+	known := false
+	for _, ext := range formats {
+		if strings.HasSuffix(lower, ext) {
+			known = true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown archive format of '%s', not one of %s", file, strings.Join(formats, ", "))
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	a := &archiveSaver{file: out, saved: make(map[string]bool), sync: sync, log: log}
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		a.zip = zip.NewWriter(out)
+		return a, nil
+	case strings.HasSuffix(lower, ".gz"), strings.HasSuffix(lower, ".tgz"):
+		a.comp = gzip.NewWriter(out)
+	case strings.HasSuffix(lower, ".zst"):
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			out.Close()
+			return nil, err
+		}
+		a.comp = zw
+	}
+	if a.comp != nil {
+		a.tar = tar.NewWriter(a.comp)
+	} else {
+		a.tar = tar.NewWriter(out)
+	}
+	return a, nil
+}
+
+// name returns the name of the URL's entry
+func (a *archiveSaver) name(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(savePath(pu), "/"), nil
+}
+
+// save adds the contents to the archive as the URL's entry
+func (a *archiveSaver) save(u string, contents []byte) (bool, error) {
+	name, err := a.name(u)
+	if err != nil {
+		return false, err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.zip != nil {
+		w, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return false, err
+		}
+		if _, err := w.Write(contents); err != nil {
+			return false, err
+		}
+	} else {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(contents)), ModTime: time.Now()}
+		if err := a.tar.WriteHeader(hdr); err != nil {
+			return false, err
+		}
+		if _, err := a.tar.Write(contents); err != nil {
+			return false, err
+		}
+	}
+	a.saved[name] = true
+	a.log.Debug("archived file", "path", name)
+	return true, nil
+}
+
+// copy adds the to URL's entry as a link to the from URL's: a hard link in a
+// tar, and a relative symbolic link in a zip
+func (a *archiveSaver) copy(from, to string) (bool, error) {
+	fromName, err := a.name(from)
+	if err != nil {
+		return false, err
+	}
+	toName, err := a.name(to)
+	if err != nil {
+		return false, err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if !a.saved[fromName] {
+		return false, fmt.Errorf("'%s' isn't in the archive", fromName)
+	}
+	if a.zip != nil {
+		target := relativeTo(path.Dir(toName), fromName)
+		hdr := &zip.FileHeader{Name: toName, Method: zip.Store, Modified: time.Now()}
+		hdr.SetMode(os.ModeSymlink | 0777)
+		w, err := a.zip.CreateHeader(hdr)
+		if err != nil {
+			return false, err
+		}
+		if _, err := io.WriteString(w, target); err != nil {
+			return false, err
+		}
+	} else {
+		hdr := &tar.Header{Typeflag: tar.TypeLink, Name: toName, Linkname: fromName, Mode: 0644, ModTime: time.Now()}
+		if err := a.tar.WriteHeader(hdr); err != nil {
+			return false, err
+		}
+	}
+	a.saved[toName] = true
+	a.log.Debug("archived link", "path", toName, "to", fromName)
+	return true, nil
+}
+
+// relativeTo returns the slash-separated path of target relative to dir
+func relativeTo(dir, target string) string {
+	if dir == "." {
+		return target
+	}
+	dirs := strings.Split(dir, "/")
+	targets := strings.Split(target, "/")
+	i := 0
+	for i < len(dirs) && i < len(targets)-1 && dirs[i] == targets[i] {
+		i++
+	}
+	rel := strings.Repeat("../", len(dirs)-i)
+	return rel + strings.Join(targets[i:], "/")
+}
+
+// Close finishes the archive, and closes its file
+func (a *archiveSaver) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var err error
+	if a.zip != nil {
+		err = a.zip.Close()
+	} else {
+		err = a.tar.Close()
+		if a.comp != nil {
+			if cerr := a.comp.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}
+	if err == nil && a.sync {
+		err = a.file.Sync()
+	}
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package fetcher
+
+import (
+	"bufio"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostBlocklist is the hosts of -exclude-hosts-file, reloaded when it changes
+type hostBlocklist struct {
+	file string
+	log  *slog.Logger // Where diagnostics are logged
+
+	lock  sync.RWMutex
+	mod   time.Time
+	hosts map[string]bool
+}
+
+// loadBlocklist returns a hostBlocklist of the hosts in the file, one per line,
+// ignoring blank lines and # comments
+func loadBlocklist(file string, log *slog.Logger) (*hostBlocklist, error) {
+	b := &hostBlocklist{file: file, log: log}
+	if _, err := b.reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// reload rereads the file if it was modified since it was last read,
+// returning true if it was
+func (b *hostBlocklist) reload() (bool, error) {
+	fi, err := os.Stat(b.file)
+	if err != nil {
+		return false, err
+	}
+	b.lock.RLock()
+	same := fi.ModTime().Equal(b.mod)
+	b.lock.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	f, err := os.Open(b.file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	hosts := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.ToLower(strings.TrimSpace(line)); line != "" {
+			hosts[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+
+	b.lock.Lock()
+	b.mod = fi.ModTime()
+	b.hosts = hosts
+	b.lock.Unlock()
+	return true, nil
+}
+
+// watch polls the file every interval, reloading it when it changes,
+// until the done channel is closed
+func (b *hostBlocklist) watch(interval time.Duration, done <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if changed, err := b.reload(); err != nil {
+				b.log.Error("could not reload -exclude-hosts-file", "path", b.file, "error", err)
+			} else if changed {
+				b.lock.RLock()
+				b.log.Info("reloaded -exclude-hosts-file", "path", b.file, "hosts", len(b.hosts))
+				b.lock.RUnlock()
+			}
+		}
+	}
+}
+
+// blocked returns true if the URL's host, or a domain it is in, is listed
+func (b *hostBlocklist) blocked(u *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for host != "" {
+		if b.hosts[host] {
+			return true
+		}
+		_, host, _ = strings.Cut(host, ".")
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// casSaver is a saver into a content-addressable store, for -save-cas. Each
+// unique body is stored once, as objects/<first two of its sha256>/<sha256>,
+// and every URL saved is appended to manifest.jsonl with the hash of its body
+type casSaver struct {
+	// The 64-bit counters are first, to be aligned for atomic access
+	stored     int64 // Bodies stored
+	duplicates int64 // Bodies already stored
+	dupBytes   int64 // Bytes of the bodies already stored
+
+	dir      string
+	lock     sync.Mutex
+	manifest *os.File
+	hashes   map[string]string // Hash of each URL saved this run, for copy
+	sync     bool              // Whether to fsync the objects and manifest
+	log      *slog.Logger      // Where diagnostics are logged
+}
+
+// casEntry is a line of the manifest
+type casEntry struct {
+	URL    string    `json:"url"`
+	SHA256 string    `json:"sha256"`
+	Size   int64     `json:"size"`
+	Saved  time.Time `json:"saved"`
+}
+
+// newCASSaver returns a casSaver into the dir, creating it if need be, and
+// appending to any manifest already there. If sync is set, the objects and
+// manifest are fsynced as they're written
+func newCASSaver(dir string, sync bool, log *slog.Logger) (*casSaver, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0755); err != nil {
+		return nil, err
+	}
+	manifest, err := os.OpenFile(filepath.Join(dir, "manifest.jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &casSaver{dir: dir, manifest: manifest, hashes: make(map[string]string), sync: sync, log: log}, nil
+}
+
+// path returns the file the body with the hash is stored in
+func (c *casSaver) path(hash string) string {
+	return filepath.Join(c.dir, "objects", hash[:2], hash)
+}
+
+// save stores the contents, unless they already are, and records the URL's
+// hash of them in the manifest
+func (c *casSaver) save(u string, contents []byte) (bool, error) {
+	hash := fmt.Sprintf("%x", sha256.Sum256(contents))
+	file := c.path(hash)
+
+	written := false
+	if _, err := os.Stat(file); err == nil {
+		atomic.AddInt64(&c.duplicates, 1)
+		atomic.AddInt64(&c.dupBytes, int64(len(contents)))
+	} else {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return false, err
+		}
+		// Getters may store the same body at once, but each writes its own
+		// temporary file, and the last rename wins
+		if err := writeFile(file, contents, c.sync); err != nil {
+			return false, err
+		}
+		atomic.AddInt64(&c.stored, 1)
+		written = true
+		c.log.Debug("stored body", "url", u, "sha256", hash)
+	}
+	return written, c.record(u, hash, int64(len(contents)))
+}
+
+// copy records the from URL's body as the to URL's in the manifest too
+func (c *casSaver) copy(from, to string) (bool, error) {
+	c.lock.Lock()
+	hash, ok := c.hashes[from]
+	c.lock.Unlock()
+	if !ok {
+		return false, fmt.Errorf("'%s' wasn't stored", from)
+	}
+	fi, err := os.Stat(c.path(hash))
+	if err != nil {
+		return false, err
+	}
+	atomic.AddInt64(&c.duplicates, 1)
+	atomic.AddInt64(&c.dupBytes, fi.Size())
+	return false, c.record(to, hash, fi.Size())
+}
+
+// record appends the URL's entry to the manifest
+func (c *casSaver) record(u, hash string, size int64) error {
+	b, err := json.Marshal(casEntry{URL: u, SHA256: hash, Size: size, Saved: time.Now()})
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hashes[u] = hash
+	if _, err = c.manifest.Write(append(b, '\n')); err == nil && c.sync {
+		err = c.manifest.Sync()
+	}
+	return err
+}
+
+// Close closes the manifest
+func (c *casSaver) Close() error {
+	return c.manifest.Close()
+}
@@ -0,0 +1,142 @@
+package fetcher
+
+import (
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// encodings are the content codings -compress may ask for
+var encodings = map[string]bool{"br": true, "gzip": true, "zstd": true, "deflate": true, "identity": true}
+
+// parseCompress returns the content codings of the comma-separated list,
+// in order of preference
+func parseCompress(list string) ([]string, error) {
+	var codings []string
+	for _, c := range strings.Split(list, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		if !encodings[c] {
+			return nil, fmt.Errorf("unknown encoding '%s'", c)
+		}
+		codings = append(codings, c)
+	}
+	if len(codings) == 0 {
+		return nil, fmt.Errorf("no encodings")
+	}
+	return codings, nil
+}
+
+// compressTransport is an http.RoundTripper that asks for the codings with
+// Accept-Encoding, instead of the transport's own gzip, and unless raw,
+// decodes the response bodies so encoded
+type compressTransport struct {
+	rt       http.RoundTripper
+	encoding string // The Accept-Encoding
+	raw      bool   // Leave the bodies encoded
+}
+
+// RoundTrip sets the Accept-Encoding of a clone of the request, round-trips
+// it, and decodes the response body
+func (t *compressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", t.encoding)
+	}
+	response, err := t.rt.RoundTrip(req)
+	if err != nil || t.raw {
+		return response, err
+	}
+
+	coding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+	if coding == "" || coding == "identity" || req.Method == http.MethodHead || response.StatusCode == http.StatusNoContent || response.StatusCode == http.StatusNotModified {
+		return response, nil
+	}
+	body, err := newDecodedBody(coding, response.Body)
+	if err != nil {
+		response.Body.Close()
+		return nil, fmt.Errorf("could not decode %s body: %w", coding, err)
+	}
+	response.Body = body
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+	return response, nil
+}
+
+// decodedBody is a response body being decoded, which counts the encoded
+// bytes read off the wire
+type decodedBody struct {
+	io.Reader
+	wire  *countingReader
+	raw   io.Closer
+	close func() // Releases the decoder, if it needs to be
+}
+
+// newDecodedBody returns the body decoded from the coding. Unknown codings
+// are an error
+func newDecodedBody(coding string, body io.ReadCloser) (*decodedBody, error) {
+	d := &decodedBody{wire: &countingReader{r: body}, raw: body}
+	switch coding {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(d.wire)
+		if err != nil {
+			return nil, err
+		}
+		d.Reader = zr
+	case "deflate":
+		zr, err := zlib.NewReader(d.wire)
+		if err != nil {
+			return nil, err
+		}
+		d.Reader = zr
+		d.close = func() { zr.Close() }
+	case "br":
+		d.Reader = brotli.NewReader(d.wire)
+	case "zstd":
+		zr, err := zstd.NewReader(d.wire)
+		if err != nil {
+			return nil, err
+		}
+		d.Reader = zr
+		d.close = zr.Close
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding")
+	}
+	return d, nil
+}
+
+// Close closes the decoder and the body
+func (d *decodedBody) Close() error {
+	if d.close != nil {
+		d.close()
+	}
+	return d.raw.Close()
+}
+
+// wireSize returns the number of encoded bytes read so far
+func (d *decodedBody) wireSize() int64 {
+	return d.wire.n
+}
+
+// countingReader is an io.Reader that counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the reader, counting the bytes
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
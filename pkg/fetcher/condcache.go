@@ -0,0 +1,95 @@
+package fetcher
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// validatorCache keeps the ETag and Last-Modified of each URL's last 200
+// response in a directory, one file per URL, so later runs can make
+// conditional requests for them, for -cache-dir
+type validatorCache struct {
+	dir string
+	log *slog.Logger // Where diagnostics are logged
+}
+
+// validators are a URL's cached ETag and Last-Modified
+type validators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// newValidatorCache returns a validatorCache in the dir, creating it if need be
+func newValidatorCache(dir string, log *slog.Logger) (*validatorCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &validatorCache{dir: dir, log: log}, nil
+}
+
+// path returns the file the URL's validators are kept in
+func (v *validatorCache) path(u string) string {
+	return filepath.Join(v.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(u))))
+}
+
+// condition adds If-None-Match and If-Modified-Since headers to the request
+// for its URL's cached validators, if there are any
+func (v *validatorCache) condition(u string, hreq *http.Request) {
+	b, err := os.ReadFile(v.path(u))
+	if err != nil {
+		return
+	}
+	var val validators
+	if err := json.Unmarshal(b, &val); err != nil || val.URL != u {
+		return
+	}
+	if val.ETag != "" {
+		hreq.Header.Set("If-None-Match", val.ETag)
+	}
+	if val.LastModified != "" {
+		hreq.Header.Set("If-Modified-Since", val.LastModified)
+	}
+}
+
+// store caches the validators of the URL's response, if it has any
+func (v *validatorCache) store(u string, response *http.Response) {
+	val := validators{
+		URL:          u,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}
+	if val.ETag == "" && val.LastModified == "" {
+		return
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		v.log.Error("could not encode -cache-dir validators", "url", u, "error", err)
+		return
+	}
+
+	// Getters may store the same URL at once, so each writes its own
+	// temporary file, and the last rename wins
+	file := v.path(u)
+	tmp, err := os.CreateTemp(v.dir, filepath.Base(file)+".*.tmp")
+	if err != nil {
+		v.log.Error("could not write -cache-dir validators", "url", u, "error", err)
+		return
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		v.log.Error("could not write -cache-dir validators", "url", u, "error", err)
+		return
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		v.log.Error("could not write -cache-dir validators", "url", u, "error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package fetcher
+
+import (
+	"github.com/itchyny/gojq"
+
+	"log/slog"
+	neturl "net/url"
+	"regexp"
+	"time"
+)
+
+// Config is the settings of a Fetcher, populated from the flags (and any
+// -profile) by Configure
+type Config struct {
+	MaxRequests     int            // maximum number of outstanding HTTP get requests allowed
+	MaxFile         string         // File to reread MaxRequests from on SIGUSR2, if set
+	ControlSocket   string         // Unix socket to accept control commands on, if set
+	SleepTime       time.Duration  // Duration to sleep between GETter spawns
+	Jitter          float64        // Fraction to randomly vary SleepTime and Every by
+	ErrOnly         bool           // Quiet unless 0 == Code >= 400
+	Quiet           bool           // No output per URL at all
+	Verbose         int            // Detail to add to each URL's line: 0, 1 (-v) or 2 (-vv)
+	NoColor         bool           // Disable colorizing
+	NoDNSCache      bool           // Disable DNS caching
+	DNSTTL          time.Duration  // How often to refresh the DNS cache
+	DNSPrefetch     bool           // Resolve the input's hostnames into the DNS cache before fetching
+	Summary         bool           // Output final stats
+	StatsJSON       bool           // Output the final stats as JSON instead
+	StatsByHost     bool           // Include per-host tallies in the final stats
+	TopN            int            // Number of slowest responses to include in the final stats
+	StatsFile       string         // File to write the final stats to as JSON, if set
+	HARFile         string         // File to write a HAR of the requests to, if set
+	HARSecrets      bool           // Keep credentials in the HAR's header fields
+	Save            bool           // Enable saving the file
+	Bar             bool           // Use progress bar
+	Guess           int            // Guesstimate of number of GETs (useful with -bar)
+	Debug           bool           // Enable debugging
+	DebugAddr       string         // Address to serve pprof and expvar on while running, if set
+	ResponseDebug   bool           // Enable full response output if debug
+	Timeout         time.Duration  // How long each GET request may take
+	ConnectTimeout  time.Duration  // How long establishing each connection (and its TLS) may take
+	TTFBTimeout     time.Duration  // How long the response headers may take after the request is sent
+	LocalAddrs      stringList     // Local IP addresses to round-robin connections from, if any
+	UnixSocket      string         // Unix socket to make all connections to, if set
+	LenientURLs     bool           // Percent-encode illegal characters in input URLs
+	FileURLs        bool           // Read file:// URLs from the local filesystem
+	AllowComments   bool           // Ignore blank and # comment lines of input
+	ExpectBody      *regexp.Regexp // Bodies must match this, if set
+	RejectBody      *regexp.Regexp // Bodies must not match this, if set
+	ExpectJSON      *gojq.Code     // JSON bodies must evaluate true with this, if set
+	InputFormat     string         // Format of the input lines
+	URLColumn       int            // Column of -input csv or tsv rows holding the URL, from 1
+	CarryColumns    []carryColumn  // Columns of -input csv or tsv rows to carry through to the output
+	Method          string         // HTTP method for requests without their own
+	RequestBody     []byte         // Body for requests without their own
+	ContentType     string         // Content-Type for request bodies, autodetected if empty
+	InputFiles      stringList     // Files to read URLs from, "-" being STDIN
+	ConvertLinks    bool           // Rewrite links in saved HTML to relative paths after the run
+	Sitemaps        stringList     // Sitemap URLs to read URLs from
+	Crawl           bool           // Crawl same-origin links in HTML responses
+	MaxDepth        int            // Maximum crawl depth, 0 being unlimited
+	PageRequisites  bool           // Also get the images, stylesheets, and scripts of HTML responses
+	Mirror          bool           // Crawl, save, and convert links, for a browsable offline mirror
+	Sparklines      bool           // Output per-host latency sparklines with the stats
+	RespectRobots   bool           // Skip URLs disallowed by robots.txt, and honor Crawl-delay
+	ProxyURL        *neturl.URL    // Proxy to use instead of any from the environment
+	Dedupe          bool           // Drop duplicate input URLs
+	Normalize       bool           // Normalize input URLs
+	SortQuery       bool           // Sort query parameters when normalizing
+	MatchURLs       *regexp.Regexp // Only input URLs matching this are fetched, if set
+	PutMode         bool           // Input lines pair URLs with files to upload to them
+	VerifyUpload    string         // How to verify uploads: etag, head, or get
+	Tus             bool           // Upload with the tus.io resumable protocol
+	ChunkSize       int64          // Size of each tus upload chunk, or S3 upload part
+	TLSSessionCache int            // Number of TLS sessions to cache for resumption
+	VerifyMirror    string         // Mirror directory to compare responses to, instead of saving, if set
+	Expand          bool           // Expand curl-style globs in input URLs
+	MaxRedirects    int            // Redirects to follow before reporting a chain
+	FailedFile      string         // File to append the URLs of unsuccessful responses to, if set
+	OKFile          string         // File to write the URLs of successful responses to, if set
+	ErrFile         string         // File to write the URLs of unsuccessful responses to, if set
+	AbortAfter      int            // Number of unsuccessful results to abort the run after, if set
+	IsolateConns    bool           // Give each getter its own Transport
+	OutputFormat    string         // Format of result output: text, json, or csv
+	FromResults     stringList     // Previous results files to read URLs from
+	FromHAR         stringList     // HAR files to replay the requests of
+	OnlyCodes       codeRanges     // Codes of previous results to read URLs from, if set
+	Sessions        int            // Number of simulated users, if non-zero
+	StateFile       string         // File to record completed URLs in, and skip those already there, if set
+	UnfetchedFile   string         // File to write the requests not fetched because of an abort to, if set
+	Gate            []gateCond     // Conditions the run's stats must meet, else exiting non-zero
+	ExitOn          []gateCond     // Conditions of the exit policies, else exiting non-zero
+	Every           time.Duration  // Interval to rerun the input at, if non-zero
+	Command         string         // Subcommand to run instead of fetching, if any
+	Listen          string         // Address for the serve subcommand to listen on
+	GRPCListen      string         // Address for the serve subcommand to serve gRPC on, if set
+	RedisURL        string         // Redis to consume the RedisQueue from, if set
+	RedisQueue      string         // Key of the Redis list or stream to consume
+	RedisGroup      string         // Consumer group to consume a Redis stream in
+	RedisReclaim    time.Duration  // How long Redis items may go unacknowledged before they're reclaimed from their consumer
+	SQSURL          string         // SQS queue to consume, if set
+	KafkaBrokers    []string       // Kafka brokers to consume KafkaIn from, and produce KafkaOut to
+	KafkaIn         string         // Kafka topic to consume, if set
+	KafkaGroup      string         // Consumer group to consume KafkaIn in
+	KafkaOut        string         // Kafka topic to produce the results to, if set
+	HashBodies      bool           // Record the SHA-256 of response bodies
+	EtagDedupe      bool           // Don't download bodies whose ETag was already downloaded
+	CacheDir        string         // Directory to keep validators in for conditional requests, if set
+	HTTPCache       string         // Directory to keep an HTTP cache of responses in, if set
+	Sync            bool           // Fsync saved files
+	MaxDisk         int64          // Bytes that may be saved, if non-zero
+	SaveDisposition bool           // Name saved files by the response's Content-Disposition filename, if any
+	SaveQuery       string         // How to keep the query in saved file names: "append", "hash", or not at all if empty
+	SaveTo          string         // Object storage URL to save into, instead of the local filesystem, if set
+	SaveArchive     string         // Archive file to save into, instead of the local filesystem, if set
+	SaveCAS         string         // Content-addressable store directory to save into, instead of the local filesystem, if set
+	Compress        []string       // Content codings to ask for, instead of the transport's gzip, if set
+	NoDecompress    bool           // Leave response bodies encoded
+	ExcludeURLs     *regexp.Regexp // Input URLs matching this are not fetched, if set
+	BlocklistPoll   time.Duration  // How often to check -exclude-hosts-file for changes
+	MaxURLs         int64          // Stop after sending this many input URLs, if non-zero
+	SkipLines       int64          // Ignore this many lines of input first
+	Logger          *slog.Logger   // Where diagnostics are logged, replaced by Configure if -log-level, -log-format, -log-file, or -debug are set
+}
@@ -0,0 +1,129 @@
+package fetcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setInputs records the inputs being read, to close if draining
+func (f *Fetcher) setInputs(inputs []io.ReadCloser) {
+	f.inputsLock.Lock()
+	defer f.inputsLock.Unlock()
+	f.inputsNow = inputs
+}
+
+// drain stops reading input, so the run ends once the requests already
+// queued are done
+func (f *Fetcher) drain() {
+	f.drainOnce.Do(func() {
+		f.draining.Store(true)
+		close(f.drained)
+	})
+	f.inputsLock.Lock()
+	defer f.inputsLock.Unlock()
+	for _, i := range f.inputsNow {
+		i.Close()
+	}
+	if f.enqueuer != nil {
+		f.enqueuer.Close()
+	}
+}
+
+// listenControl listens on the Unix socket for control commands, one per line
+func (f *Fetcher) listenControl(path string) error {
+	// A stale socket from a previous run would prevent listening
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	f.controlSock = l
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			} else if err != nil {
+				f.Logger.Warn("could not accept -control connection", "error", err)
+				return
+			}
+			go f.handleControl(conn)
+		}
+	}()
+	return nil
+}
+
+// closeControl stops listening on the -control socket, if listening, which
+// removes it
+func (f *Fetcher) closeControl() {
+	if f.controlSock != nil {
+		f.controlSock.Close()
+	}
+}
+
+// handleControl reads commands from the connection, responding to each
+// with a line starting with "OK" or "ERR"
+func (f *Fetcher) handleControl(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		fmt.Fprintln(conn, f.controlCommand(strings.ToLower(fields[0]), fields[1:]))
+	}
+}
+
+// controlCommand runs the command, returning its response:
+//
+//	pause       stop making new requests
+//	resume      resume making requests
+//	setmax N    change the number of getters to N
+//	stats       the stats so far, as -stats-json (on one line)
+//	drain       stop reading input, and end once what's queued is done
+func (f *Fetcher) controlCommand(cmd string, args []string) string {
+	switch cmd {
+	case "pause", "resume":
+		f.setPause(cmd == "pause")
+		return "OK " + cmd + "d"
+	case "setmax":
+		if len(args) != 1 {
+			return "ERR usage: setmax N"
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return "ERR usage: setmax N, N being a positive number"
+		}
+		pool := f.workers.Load()
+		if pool == nil {
+			return "ERR not running: no getters have started yet"
+		}
+		pool.resize(n)
+		return fmt.Sprintf("OK %d getters", n)
+	case "stats":
+		f.liveLock.Lock()
+		rec := f.record(f.live, time.Since(f.started))
+		f.liveLock.Unlock()
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return "ERR " + err.Error()
+		}
+		return "OK " + string(b)
+	case "drain":
+		f.drain()
+		return "OK draining"
+	}
+	return "ERR unknown command '" + cmd + "', expected pause, resume, setmax N, stats, or drain"
+}
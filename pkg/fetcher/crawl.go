@@ -0,0 +1,262 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// crawler queues links found in fetched HTML back to the getters,
+// closing getChan once the input is done and no requests remain pending,
+// or ctx is cancelled. Its methods are safe to call on a nil crawler, which
+// does nothing
+type crawler struct {
+	f       *Fetcher // Whose settings to crawl by
+	ctx     context.Context
+	getChan chan getRequest
+	lock    sync.Mutex
+	cond    *sync.Cond // Broadcast when the queue, pending, or closed change
+	visited map[string]bool
+	queue   []getRequest
+	pending int       // Requests sent or queued, and not yet finished
+	closed  bool      // Whether to stop feeding
+	fed     chan bool // Closed once feed returns
+}
+
+// newCrawler returns a crawler for f feeding the getChan, until ctx is
+// cancelled
+func newCrawler(ctx context.Context, f *Fetcher, getChan chan getRequest) *crawler {
+	c := &crawler{
+		f:       f,
+		ctx:     ctx,
+		getChan: getChan,
+		visited: make(map[string]bool),
+		fed:     make(chan bool),
+	}
+	c.cond = sync.NewCond(&c.lock)
+	go c.feed()
+	return c
+}
+
+// visit marks the URL as visited, returning false if it already was
+func (c *crawler) visit(u string) bool {
+	if c == nil {
+		return true
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.visited[u] {
+		return false
+	}
+	c.visited[u] = true
+	return true
+}
+
+// sending must be called before a request is sent to getChan,
+// so it is counted as pending
+func (c *crawler) sending() {
+	if c != nil {
+		c.lock.Lock()
+		c.pending++
+		c.lock.Unlock()
+	}
+}
+
+// finished must be called by the getter once a request is done,
+// including having crawled it, or by the scanner if it couldn't be sent
+func (c *crawler) finished() {
+	if c != nil {
+		c.lock.Lock()
+		c.pending--
+		c.lock.Unlock()
+		c.cond.Broadcast()
+	}
+}
+
+// inputDone must be called once the input is exhausted. It waits for
+// all pending requests to finish, or ctx to be cancelled, and then closes
+// getChan
+func (c *crawler) inputDone() {
+	stop := context.AfterFunc(c.ctx, func() {
+		c.lock.Lock()
+		c.cond.Broadcast()
+		c.lock.Unlock()
+	})
+	defer stop()
+
+	c.lock.Lock()
+	for c.pending > 0 && c.ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	c.closed = true
+	c.lock.Unlock()
+	c.cond.Broadcast()
+
+	// feed must not send once getChan is closed
+	<-c.fed
+	close(c.getChan)
+}
+
+// feed sends the queued requests to getChan, until closed or ctx is
+// cancelled
+func (c *crawler) feed() {
+	defer close(c.fed)
+	for {
+		c.lock.Lock()
+		for len(c.queue) == 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if c.closed {
+			c.lock.Unlock()
+			return
+		}
+		req := c.queue[0]
+		c.queue = c.queue[1:]
+		c.lock.Unlock()
+
+		select {
+		case c.getChan <- req:
+		case <-c.ctx.Done():
+			// Requeue it, for -unfetched
+			c.lock.Lock()
+			c.queue = append([]getRequest{req}, c.queue...)
+			c.lock.Unlock()
+			return
+		}
+	}
+}
+
+// unqueue empties the queue of requests not yet sent to getChan, returning them
+func (c *crawler) unqueue() []getRequest {
+	if c == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	q := c.queue
+	c.queue = nil
+	return q
+}
+
+// crawl takes a request and its HTML response body, and queues any
+// unvisited same-origin links in it within MaxDepth if crawling, and
+// any unvisited page requisites if fetching them. Requisites are not
+// themselves crawled
+func (c *crawler) crawl(req *getRequest, body []byte) {
+	if c == nil || req.Requisite || c.f.draining.Load() {
+		return
+	}
+	base, err := url.Parse(req.URL)
+	if err != nil {
+		return
+	}
+
+	var found []getRequest
+	links, requisites := extractLinks(body, c.f.Logger)
+	if c.f.PageRequisites {
+		for _, link := range requisites {
+			u, _, err := resolveLink(base, link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			if c.visit(u.String()) {
+				found = append(found, getRequest{URL: u.String(), Depth: req.Depth, Requisite: true})
+			}
+		}
+	}
+	if c.f.Crawl && (c.f.MaxDepth == 0 || req.Depth < c.f.MaxDepth) {
+		for _, link := range links {
+			u, _, err := resolveLink(base, link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				continue
+			}
+			if u.Scheme != base.Scheme || u.Host != base.Host {
+				// Not same-origin
+				continue
+			}
+			if c.visit(u.String()) {
+				found = append(found, getRequest{URL: u.String(), Depth: req.Depth + 1})
+			}
+		}
+	}
+	if len(found) == 0 {
+		return
+	}
+	c.f.Logger.Debug("crawled", "url", req.URL, "new_links", len(found))
+
+	c.lock.Lock()
+	c.pending += len(found)
+	c.queue = append(c.queue, found...)
+	c.lock.Unlock()
+	c.cond.Broadcast()
+}
+
+// requisiteRels are the link rel values that are page requisites
+var requisiteRels = map[string]bool{
+	"stylesheet":       true,
+	"icon":             true,
+	"shortcut":         true,
+	"apple-touch-icon": true,
+	"preload":          true,
+}
+
+// extractLinks returns the values of every href and src attribute in the HTML
+// body, and separately, those that are page requisites: images, stylesheets,
+// scripts, and other embedded media
+func extractLinks(body []byte, log *slog.Logger) ([]string, []string) {
+	var links, requisites []string
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				log.Debug("could not parse HTML", "error", z.Err())
+			}
+			return links, requisites
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		t := z.Token()
+		var href, src, rel string
+		for _, a := range t.Attr {
+			switch a.Key {
+			case "href":
+				href = a.Val
+			case "src":
+				src = a.Val
+			case "rel":
+				rel = strings.ToLower(a.Val)
+			}
+		}
+		if href != "" {
+			links = append(links, href)
+		}
+		if src != "" {
+			links = append(links, src)
+		}
+
+		switch t.Data {
+		case "img", "script", "embed", "source", "audio", "video", "track", "input", "iframe":
+			if src != "" {
+				requisites = append(requisites, src)
+			}
+		case "link":
+			for _, r := range strings.Fields(rel) {
+				if requisiteRels[r] && href != "" {
+					requisites = append(requisites, href)
+					break
+				}
+			}
+		}
+	}
+}
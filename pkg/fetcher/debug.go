@@ -0,0 +1,75 @@
+package fetcher
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	_ "net/http/pprof" // Registers the /debug/pprof handlers
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	publishOnce sync.Once               // expvar names are process-wide, so published once
+	debugging   atomic.Pointer[Fetcher] // The Fetcher the expvars are of: the last to serve them
+)
+
+// serveDebug publishes our progress counters with expvar, and serves them
+// and net/http/pprof at the address, e.g. ":6060", until ctx is done
+func (f *Fetcher) serveDebug(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	debugging.Store(f)
+	publishOnce.Do(publishDebug)
+
+	srv := &http.Server{Handler: http.DefaultServeMux}
+	go func() {
+		f.Logger.Debug("serving pprof and expvar", "addr", addr)
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			f.Logger.Error("could not serve -debug-addr", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	return nil
+}
+
+// publishDebug publishes the progress counters of the Fetcher being debugged
+func publishDebug() {
+	expvar.Publish("in_flight", expvar.Func(func() any {
+		return atomic.LoadInt64(&debugging.Load().inFlight)
+	}))
+	expvar.Publish("workers", expvar.Func(func() any {
+		if pool := debugging.Load().workers.Load(); pool != nil {
+			return pool.Size()
+		}
+		return 0
+	}))
+	expvar.Publish("queue_depth", expvar.Func(func() any {
+		return debugging.Load().queue()
+	}))
+	expvar.Publish("results", expvar.Func(func() any {
+		return atomic.LoadInt64(&debugging.Load().collated)
+	}))
+	expvar.Publish("results_per_second", expvar.Func(func() any {
+		f := debugging.Load()
+		return float64(atomic.LoadInt64(&f.collated)) / time.Since(f.started).Seconds()
+	}))
+	expvar.Publish("net", expvar.Func(func() any {
+		f := debugging.Load()
+		return map[string]int64{
+			"dns_lookups":    atomic.LoadInt64(&f.netStats.DNSLookups),
+			"dns_cache_hits": atomic.LoadInt64(&f.netStats.DNSCacheHits),
+			"connections":    atomic.LoadInt64(&f.netStats.Connections),
+			"tls_handshakes": atomic.LoadInt64(&f.netStats.TLSHandshakes),
+			"bytes_sent":     atomic.LoadInt64(&f.netStats.BytesSent),
+			"bytes_received": atomic.LoadInt64(&f.netStats.BytesReceived),
+		}
+	}))
+}
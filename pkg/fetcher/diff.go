@@ -0,0 +1,74 @@
+package fetcher
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// loadResults returns the results of a previous run's -format json or csv
+// output file, by URL
+func (f *Fetcher) loadResults(file string) (map[string]Result, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	results := make(map[string]Result)
+	readResults(in, f.Logger, func(r Result) bool {
+		if r.Skipped == "" {
+			results[r.URL] = r
+		}
+		return true
+	})
+	return results, nil
+}
+
+// diffRuns takes the output files of two runs, and outputs the URLs whose
+// code, size, or hash changed between them, or that are only in one of them,
+// returning the number of differences
+func (f *Fetcher) diffRuns(before, after string) (int, error) {
+	a, err := f.loadResults(before)
+	if err != nil {
+		return 0, err
+	}
+	b, err := f.loadResults(after)
+	if err != nil {
+		return 0, err
+	}
+
+	urls := make([]string, 0, len(a)+len(b))
+	for u := range a {
+		urls = append(urls, u)
+	}
+	for u := range b {
+		if _, ok := a[u]; !ok {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+
+	var diffs int
+	for _, u := range urls {
+		ra, inA := a[u]
+		rb, inB := b[u]
+		switch {
+		case !inB:
+			f.colors.yellow.Printf("REMOVED %s\n", u)
+		case !inA:
+			f.colors.yellow.Printf("ADDED %s\n", u)
+		case ra.Code != rb.Code:
+			f.colors.red.Printf("CODE %d -> %d %s\n", ra.Code, rb.Code, u)
+		case ra.Size != rb.Size:
+			f.colors.red.Printf("SIZE %d -> %d %s\n", ra.Size, rb.Size, u)
+		case ra.Hash != "" && rb.Hash != "" && ra.Hash != rb.Hash:
+			f.colors.red.Printf("HASH %.12s -> %.12s %s\n", ra.Hash, rb.Hash, u)
+		default:
+			continue
+		}
+		diffs++
+	}
+	fmt.Printf("%d of %d URLs differ\n", diffs, len(urls))
+	return diffs, nil
+}
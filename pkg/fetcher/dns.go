@@ -0,0 +1,88 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// prefetchers is how many hostnames -dns-prefetch resolves at once
+const prefetchers = 16
+
+// prefetchDNS reads all of the inputs, resolving the hostnames of their
+// URLs into the dnsCache, and returns them to be read again, for
+// -dns-prefetch
+func (f *Fetcher) prefetchDNS(ctx context.Context, inputs []io.ReadCloser) []io.ReadCloser {
+	s := time.Now()
+	hosts := make(map[string]bool)
+	read := make([]io.ReadCloser, 0, len(inputs))
+	for _, input := range inputs {
+		b, err := io.ReadAll(input)
+		input.Close()
+		if err != nil {
+			f.Logger.Error("could not read input for -dns-prefetch", "error", err)
+		}
+		read = append(read, io.NopCloser(bytes.NewReader(b)))
+
+		// Long lines are skipped, as scanInput does
+		var lines lineSplitter
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+		scanner.Split(lines.split)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			req, err := f.parseLine(line)
+			if err != nil {
+				continue
+			}
+			if pu, err := neturl.Parse(req.URL); err == nil && pu.Hostname() != "" && net.ParseIP(pu.Hostname()) == nil {
+				hosts[pu.Hostname()] = true
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			f.Logger.Error("could not read input for -dns-prefetch", "error", err)
+		}
+	}
+
+	hostChan := make(chan string)
+	var (
+		wg     sync.WaitGroup
+		failed int64
+	)
+	for i := 0; i < prefetchers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range hostChan {
+				atomic.AddInt64(&f.netStats.DNSLookups, 1)
+				if _, err := f.dnsCache.Lookup(host); err != nil {
+					f.Logger.Debug("could not prefetch DNS", "host", host, "error", err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				f.dnsCached.Store(host, true)
+			}
+		}()
+	}
+	for host := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+		hostChan <- host
+	}
+	close(hostChan)
+	wg.Wait()
+
+	f.Logger.Info("prefetched DNS", "hosts", len(hosts), "failed", failed, "elapsed", time.Since(s))
+	return read
+}
@@ -0,0 +1,59 @@
+package fetcher
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// etagEntry is a response body already downloaded, for -etag-dedupe
+type etagEntry struct {
+	URL     string // URL it was downloaded from
+	SavedAs string // URL it was saved as, which may differ by -content-disposition
+	Size    int64  // Its size
+}
+
+// etagFetched returns the body already downloaded with the ETag, if any.
+// Weak ETags don't promise identical bodies, so are never matched
+func (f *Fetcher) etagFetched(etag string) (etagEntry, bool) {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return etagEntry{}, false
+	}
+	f.etagLock.Lock()
+	defer f.etagLock.Unlock()
+	e, ok := f.etagSeen[etag]
+	if ok {
+		atomic.AddInt64(&f.etagSaved, e.Size)
+	}
+	return e, ok
+}
+
+// recordETag records that the body with the ETag was downloaded from the URL,
+// and saved as the saveAs URL (if saved)
+func (f *Fetcher) recordETag(etag, u, saveAs string, size int64) {
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		return
+	}
+	f.etagLock.Lock()
+	defer f.etagLock.Unlock()
+	if _, ok := f.etagSeen[etag]; !ok {
+		f.etagSeen[etag] = etagEntry{URL: u, SavedAs: saveAs, Size: size}
+	}
+}
+
+// copySaved saves the file already saved for the from URL as that of the to
+// URL, returning whether it was written, as SaveFile does, fsyncing it if
+// sync is set
+func copySaved(from, to string, sync bool, log *slog.Logger) (bool, error) {
+	fu, err := url.Parse(from)
+	if err != nil {
+		return false, err
+	}
+	b, err := ioutil.ReadFile(savePath(fu))
+	if err != nil {
+		return false, err
+	}
+	return saveFile(to, b, sync, log)
+}
@@ -0,0 +1,159 @@
+package fetcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// globPart is a piece of a URL glob: literal text, a {list} of alternatives,
+// or a [range] of numbers or letters
+type globPart struct {
+	literal string
+	alts    []string
+	ranged  bool
+	lo, hi  int  // Range bounds, as numbers or runes
+	step    int  // Range step
+	width   int  // Zero-padded width of numeric ranges
+	letters bool // Whether the range is of letters
+}
+
+// expandURL takes a URL with curl-style globs, i.e. {a,b,c} lists and [1-10],
+// [001-100], [a-z], or [0-100:10] ranges, and calls fn with each URL they
+// expand into, in order, until fn returns false. Globs can't be nested, and
+// may be escaped with '\'
+func expandURL(raw string, fn func(string) bool) error {
+	parts, err := parseGlob(raw)
+	if err != nil {
+		return err
+	}
+	walkGlob(parts, "", fn)
+	return nil
+}
+
+// walkGlob calls fn with each expansion of the parts after prefix, returning
+// false once fn does
+func walkGlob(parts []globPart, prefix string, fn func(string) bool) bool {
+	if len(parts) == 0 {
+		return fn(prefix)
+	}
+	p, rest := parts[0], parts[1:]
+	switch {
+	case p.ranged:
+		for i := p.lo; i <= p.hi; i += p.step {
+			var s string
+			if p.letters {
+				s = string(rune(i))
+			} else {
+				s = fmt.Sprintf("%0*d", p.width, i)
+			}
+			if !walkGlob(rest, prefix+s, fn) {
+				return false
+			}
+		}
+		return true
+	case p.alts != nil:
+		for _, a := range p.alts {
+			if !walkGlob(rest, prefix+a, fn) {
+				return false
+			}
+		}
+		return true
+	default:
+		return walkGlob(rest, prefix+p.literal, fn)
+	}
+}
+
+// parseGlob splits the raw URL into its globParts
+func parseGlob(raw string) ([]globPart, error) {
+	var (
+		parts []globPart
+		lit   strings.Builder
+	)
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch c {
+		case '\\':
+			if i+1 < len(raw) && strings.IndexByte(`[]{}\`, raw[i+1]) >= 0 {
+				i++
+				lit.WriteByte(raw[i])
+			} else {
+				lit.WriteByte(c)
+			}
+		case '{', '[':
+			closer := byte('}')
+			if c == '[' {
+				closer = ']'
+				if strings.HasSuffix(raw[:i], "://") || strings.HasSuffix(raw[:i], "@") {
+					// An IPv6 literal, not a range
+					lit.WriteByte(c)
+					continue
+				}
+			}
+			end := strings.IndexByte(raw[i:], closer)
+			if end < 0 {
+				return nil, fmt.Errorf("unmatched '%c' at %d", c, i)
+			}
+			body := raw[i+1 : i+end]
+			if n := strings.IndexAny(body, "{["); n >= 0 {
+				return nil, fmt.Errorf("nested '%c' at %d", body[n], i+1+n)
+			}
+			var (
+				p   globPart
+				err error
+			)
+			if c == '{' {
+				p.alts = strings.Split(body, ",")
+			} else if p, err = parseRange(body); err != nil {
+				return nil, err
+			}
+			parts = append(parts, globPart{literal: lit.String()}, p)
+			lit.Reset()
+			i += end
+		default:
+			lit.WriteByte(c)
+		}
+	}
+	return append(parts, globPart{literal: lit.String()}), nil
+}
+
+// parseRange parses the body of a [lo-hi] or [lo-hi:step] range
+func parseRange(body string) (globPart, error) {
+	p := globPart{ranged: true, step: 1}
+	r, step, stepped := strings.Cut(body, ":")
+	if stepped {
+		s, err := strconv.Atoi(step)
+		if err != nil || s < 1 {
+			return p, fmt.Errorf("invalid step in range '[%s]'", body)
+		}
+		p.step = s
+	}
+
+	lo, hi, ok := strings.Cut(r, "-")
+	if !ok || lo == "" || hi == "" {
+		return p, fmt.Errorf("invalid range '[%s]'", body)
+	}
+	if len(lo) == 1 && len(hi) == 1 && isLetter(lo[0]) && isLetter(hi[0]) {
+		p.letters = true
+		p.lo, p.hi = int(lo[0]), int(hi[0])
+	} else {
+		var err1, err2 error
+		p.lo, err1 = strconv.Atoi(lo)
+		p.hi, err2 = strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || p.lo < 0 {
+			return p, fmt.Errorf("invalid range '[%s]'", body)
+		}
+		if strings.HasPrefix(lo, "0") {
+			p.width = len(lo)
+		}
+	}
+	if p.lo > p.hi {
+		return p, fmt.Errorf("backwards range '[%s]'", body)
+	}
+	return p, nil
+}
+
+// isLetter returns true if the byte is an ASCII letter
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
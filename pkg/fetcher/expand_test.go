@@ -0,0 +1,74 @@
+package fetcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandURL(t *testing.T) {
+	tests := []struct {
+		name, url string
+		want      []string // Expansions, or nil if it fails
+	}{
+		{"no glob", "http://example.com/a", []string{"http://example.com/a"}},
+		{"list", "http://example.com/{a,b,c}", []string{"http://example.com/a", "http://example.com/b", "http://example.com/c"}},
+		{"empty alternative", "http://example.com/a{,.html}", []string{"http://example.com/a", "http://example.com/a.html"}},
+		{"range", "http://example.com/[1-3]", []string{"http://example.com/1", "http://example.com/2", "http://example.com/3"}},
+		{"zero-padded range", "http://example.com/[08-11]", []string{"http://example.com/08", "http://example.com/09", "http://example.com/10", "http://example.com/11"}},
+		{"zero-padded range, wider", "http://example.com/[001-002]", []string{"http://example.com/001", "http://example.com/002"}},
+		{"stepped range", "http://example.com/[0-25:10]", []string{"http://example.com/0", "http://example.com/10", "http://example.com/20"}},
+		{"stepped zero-padded range", "http://example.com/[00-10:5]", []string{"http://example.com/00", "http://example.com/05", "http://example.com/10"}},
+		{"letter range", "http://example.com/[x-z]", []string{"http://example.com/x", "http://example.com/y", "http://example.com/z"}},
+		{"uppercase letter range, stepped", "http://example.com/[A-E:2]", []string{"http://example.com/A", "http://example.com/C", "http://example.com/E"}},
+		{"several globs", "http://{a,b}.example.com/[1-2]", []string{"http://a.example.com/1", "http://a.example.com/2", "http://b.example.com/1", "http://b.example.com/2"}},
+		{"escaped", `http://example.com/\{a,b\}\[1-2\]`, []string{"http://example.com/{a,b}[1-2]"}},
+		{"IPv6 literal", "http://[::1]/[1-2]", []string{"http://[::1]/1", "http://[::1]/2"}},
+		{"IPv6 literal with userinfo", "http://u@[::1]/", []string{"http://u@[::1]/"}},
+		{"stray closing brace", "http://example.com/a}b", []string{"http://example.com/a}b"}},
+		{"nested braces", "http://example.com/{a,{b,c}}", nil},
+		{"range nested in braces", "http://example.com/{a,[1-2]}", nil},
+		{"brace nested in range", "http://example.com/[1-{2,3}]", nil},
+		{"unmatched brace", "http://example.com/{a,b", nil},
+		{"unmatched bracket", "http://example.com/[1-2", nil},
+		{"backwards range", "http://example.com/[3-1]", nil},
+		{"range without bounds", "http://example.com/[1-]", nil},
+		{"range of mixed letters and numbers", "http://example.com/[a-9]", nil},
+		{"zero step", "http://example.com/[1-9:0]", nil},
+		{"non-numeric step", "http://example.com/[1-9:x]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := expandURL(tt.url, func(u string) bool {
+				got = append(got, u)
+				return true
+			})
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("expandURL(%q) = %q, want an error", tt.url, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandURL(%q): %s", tt.url, err)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("expandURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandURLStops(t *testing.T) {
+	var got []string
+	err := expandURL("http://example.com/[1-100]", func(u string) bool {
+		got = append(got, u)
+		return len(got) < 3
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Errorf("got %d expansions, want 3 before fn returned false", len(got))
+	}
+}
@@ -0,0 +1,229 @@
+package fetcher
+
+import (
+	"github.com/jlaffaye/ftp"
+
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ftpTransport is an http.RoundTripper for ftp:// and ftps:// (explicit TLS,
+// AUTH TLS) URLs, registered with the transport. Each request logs in over a
+// new control connection, as the URL's user or anonymous, and is answered as
+// an HTTP server would: GET retrieves the file, or lists the directory if the
+// path ends in a /, HEAD just its size and modification time, and files that
+// are unavailable are 404s
+type ftpTransport struct {
+	dial     func(ctx context.Context, network, address string) (net.Conn, error)
+	sessions tls.ClientSessionCache // So ftps data connections can resume the control connection's session
+}
+
+// RoundTrip makes the request over FTP
+func (t *ftpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return localResponse(req, "FTP", http.StatusMethodNotAllowed, req.Method+" is not supported over FTP"), nil
+	}
+	if crossSchemeRedirect(req) {
+		return localResponse(req, "FTP", http.StatusForbidden, "not following a redirect from "+req.Response.Request.URL.Scheme+" to FTP"), nil
+	}
+
+	ctx := req.Context()
+	addr := req.URL.Host
+	if req.URL.Port() == "" {
+		addr = net.JoinHostPort(req.URL.Hostname(), "21")
+	}
+
+	// The control and data connections are closed if the request is
+	// cancelled or times out, as the ftp package doesn't watch the context
+	conns := &ftpConns{}
+	stop := context.AfterFunc(ctx, conns.close)
+	var tlsConfig *tls.Config
+	if req.URL.Scheme == "ftps" {
+		tlsConfig = &tls.Config{ServerName: req.URL.Hostname(), ClientSessionCache: t.sessions}
+	}
+	opts := []ftp.DialOption{ftp.DialWithContext(ctx), ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+		conn, err := t.dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		if conns.add(conn) > 1 && tlsConfig != nil {
+			// Data connections, which the ftp package leaves to us
+			conn = tls.Client(conn, tlsConfig)
+		}
+		return conn, nil
+	})}
+	if tlsConfig != nil {
+		opts = append(opts, ftp.DialWithExplicitTLS(tlsConfig))
+	}
+
+	c, err := ftp.Dial(addr, opts...)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	done := func() {
+		c.Quit()
+		stop()
+		conns.close()
+	}
+
+	user, password := "anonymous", "anonymous"
+	if req.URL.User != nil {
+		user = req.URL.User.Username()
+		password, _ = req.URL.User.Password()
+	}
+	if err := c.Login(user, password); err != nil {
+		done()
+		if code := ftpCode(err); code != 0 {
+			return localResponse(req, "FTP", http.StatusUnauthorized, err.Error()), nil
+		}
+		return nil, err
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	path := req.URL.Path
+	if path == "" || strings.HasSuffix(path, "/") {
+		if path == "" {
+			path = "/"
+		}
+		wrote(trace)
+		names, err := c.NameList(path)
+		gotFirstByte(trace)
+		done()
+		if err != nil {
+			return ftpError(req, err)
+		}
+		response := localResponse(req, "FTP", http.StatusOK, "")
+		var listing bytes.Buffer
+		for _, name := range names {
+			listing.WriteString(name + "\n")
+		}
+		response.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		response.ContentLength = int64(listing.Len())
+		if req.Method == http.MethodGet {
+			response.Body = io.NopCloser(&listing)
+		}
+		return response, nil
+	}
+
+	wrote(trace)
+	size, err := c.FileSize(path)
+	if err != nil {
+		done()
+		return ftpError(req, err)
+	}
+	response := localResponse(req, "FTP", http.StatusOK, "")
+	response.ContentLength = size
+	response.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	if c.IsGetTimeSupported() {
+		if modified, err := c.GetTime(path); err == nil {
+			response.Header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+			if ims, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !modified.Truncate(time.Second).After(ims) {
+				gotFirstByte(trace)
+				done()
+				response.StatusCode = http.StatusNotModified
+				response.Status = "304 " + http.StatusText(http.StatusNotModified)
+				response.ContentLength = 0
+				response.Header.Del("Content-Length")
+				return response, nil
+			}
+		}
+	}
+	if req.Method == http.MethodHead {
+		gotFirstByte(trace)
+		done()
+		return response, nil
+	}
+
+	r, err := c.Retr(path)
+	gotFirstByte(trace)
+	if err != nil {
+		done()
+		return ftpError(req, err)
+	}
+	response.Body = &ftpBody{Response: r, done: done}
+	return response, nil
+}
+
+// ftpConns are the connections made for an FTP request
+type ftpConns struct {
+	lock  sync.Mutex
+	conns []net.Conn
+}
+
+// add adds the connection, returning how many there have been
+func (f *ftpConns) add(conn net.Conn) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.conns = append(f.conns, conn)
+	return len(f.conns)
+}
+
+// close closes the connections
+func (f *ftpConns) close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+// ftpBody is the body of a retrieved file, which closes the control
+// connection once closed
+type ftpBody struct {
+	*ftp.Response
+	done func()
+}
+
+// Close closes the data and control connections
+func (b *ftpBody) Close() error {
+	err := b.Response.Close()
+	b.done()
+	return err
+}
+
+// ftpError returns the response to the request for the error: a 404 if the
+// server replied that the file is unavailable, otherwise the error itself
+func ftpError(req *http.Request, err error) (*http.Response, error) {
+	switch ftpCode(err) {
+	case ftp.StatusFileUnavailable, ftp.StatusFileActionIgnored:
+		return localResponse(req, "FTP", http.StatusNotFound, err.Error()), nil
+	case ftp.StatusNotLoggedIn:
+		return localResponse(req, "FTP", http.StatusForbidden, err.Error()), nil
+	}
+	return nil, err
+}
+
+// ftpCode returns the FTP reply code of the error, or 0 if it isn't a reply
+func ftpCode(err error) int {
+	var terr *textproto.Error
+	if errors.As(err, &terr) {
+		return terr.Code
+	}
+	return 0
+}
+
+// wrote tells the trace the request has been sent, so its TTFB is timed
+func wrote(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{})
+	}
+}
+
+// gotFirstByte tells the trace the first of the response has arrived
+func gotFirstByte(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+}
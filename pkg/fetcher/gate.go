@@ -0,0 +1,212 @@
+package fetcher
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gateOps are the comparison operators of gate conditions, longest first
+var gateOps = []string{"<=", ">=", "<", ">"}
+
+// gateCond is a condition of a -gate, e.g. "p99<800ms"
+type gateCond struct {
+	Spec   string  // The condition as given
+	Metric string  // p50, p99.9, avg, max, error_rate, unsuccessful, 5xx, ...
+	Op     string  // One of gateOps
+	Value  float64 // In milliseconds for latencies, as a fraction for rates
+}
+
+// parseGate parses a comma-delimited list of gate conditions
+func parseGate(spec string) ([]gateCond, error) {
+	var conds []gateCond
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var c gateCond
+		for _, op := range gateOps {
+			if m, v, ok := strings.Cut(s, op); ok {
+				c = gateCond{Spec: s, Metric: strings.ToLower(strings.TrimSpace(m)), Op: op}
+				s = strings.TrimSpace(v)
+				break
+			}
+		}
+		if c.Op == "" {
+			return nil, fmt.Errorf("no comparison in '%s'", s)
+		}
+
+		var err error
+		switch {
+		case isLatencyMetric(c.Metric):
+			var d time.Duration
+			d, err = time.ParseDuration(s)
+			c.Value = ms(d)
+		case strings.HasSuffix(c.Metric, "_rate"):
+			if p, ok := strings.CutSuffix(s, "%"); ok {
+				c.Value, err = strconv.ParseFloat(p, 64)
+				c.Value /= 100
+			} else {
+				c.Value, err = strconv.ParseFloat(s, 64)
+			}
+		default:
+			c.Value, err = strconv.ParseFloat(s, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in '%s': %w", c.Spec, err)
+		}
+		if _, err := (&stat{}).gateMetric(c.Metric); err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+// isLatencyMetric returns true if the metric is a latency, e.g. p99 or avg
+func isLatencyMetric(m string) bool {
+	if m == "avg" || m == "max" || m == "min" {
+		return true
+	}
+	if p, ok := strings.CutPrefix(m, "p"); ok {
+		_, err := strconv.ParseFloat(p, 64)
+		return err == nil
+	}
+	return false
+}
+
+// gateMetric returns the value of the metric for the stats, in milliseconds
+// for latencies, as a fraction for rates
+func (s *stat) gateMetric(m string) (float64, error) {
+	bad := s.Errors + s.Failures + s.Mismatches + s.Error4s + s.Error5s + s.Redirects
+	rate := func(n int) float64 {
+		if s.Count == 0 {
+			return 0
+		}
+		return float64(n) / float64(s.Count)
+	}
+
+	switch m {
+	case "avg":
+		return ms(s.Latency.mean()), nil
+	case "min", "max":
+		if m == "min" {
+			return ms(s.Latency.Min), nil
+		}
+		return ms(s.Latency.Max), nil
+	case "error_rate":
+		return rate(bad), nil
+	case "5xx_rate":
+		return rate(s.Error5s), nil
+	case "4xx_rate":
+		return rate(s.Error4s), nil
+	case "count", "gets":
+		return float64(s.Count), nil
+	case "errors", "unsuccessful":
+		return float64(bad), nil
+	case "4xx":
+		return float64(s.Error4s), nil
+	case "5xx":
+		return float64(s.Error5s), nil
+	}
+	if p, ok := strings.CutPrefix(m, "p"); ok {
+		if f, err := strconv.ParseFloat(p, 64); err == nil && f > 0 && f <= 100 {
+			return ms(s.Latency.percentile(f)), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gate metric '%s'", m)
+}
+
+// exitPolicies are the -exit-on-error policies, as gate conditions
+var exitPolicies = map[string]string{
+	"any": "unsuccessful<=0",
+	"4xx": "4xx<=0",
+	"5xx": "5xx<=0",
+}
+
+// parseExitPolicies returns the gate conditions of the comma-delimited list
+// of exitPolicies, and of the maximum error rate, if set (e.g. "1%")
+func parseExitPolicies(policies, maxRate string) ([]gateCond, error) {
+	var specs []string
+	for _, p := range strings.Split(policies, ",") {
+		if p = strings.ToLower(strings.TrimSpace(p)); p == "" {
+			continue
+		}
+		spec, ok := exitPolicies[p]
+		if !ok {
+			return nil, fmt.Errorf("unknown policy '%s'", p)
+		}
+		specs = append(specs, spec)
+	}
+	if maxRate != "" {
+		specs = append(specs, "error_rate<="+maxRate)
+	}
+	return parseGate(strings.Join(specs, ","))
+}
+
+// checkGate outputs a report of the named gate's conditions against the
+// stats, in the colors, returning false if any are violated
+func (s *stat) checkGate(name string, conds []gateCond, colors *palette) bool {
+	pass := true
+	fmt.Printf("%s:\n", name)
+	for _, c := range conds {
+		v, _ := s.gateMetric(c.Metric)
+		var ok bool
+		switch c.Op {
+		case "<":
+			ok = v < c.Value
+		case "<=":
+			ok = v <= c.Value
+		case ">":
+			ok = v > c.Value
+		case ">=":
+			ok = v >= c.Value
+		}
+
+		actual := strconv.FormatFloat(v, 'f', -1, 64)
+		if isLatencyMetric(c.Metric) {
+			actual = time.Duration(v * float64(time.Millisecond)).String()
+		} else if strings.HasSuffix(c.Metric, "_rate") {
+			actual = strconv.FormatFloat(v*100, 'f', 3, 64) + "%"
+		}
+		switch c.Metric {
+		case "errors", "unsuccessful", "error_rate":
+			// Which of the unsuccessful responses there were
+			actual += s.unsuccessful()
+		}
+		if ok {
+			colors.green.Printf("  PASS %s (%s=%s)\n", c.Spec, c.Metric, actual)
+		} else {
+			colors.red.Printf("  FAIL %s (%s=%s)\n", c.Spec, c.Metric, actual)
+			pass = false
+		}
+	}
+	return pass
+}
+
+// unsuccessful returns the counts of each kind of unsuccessful response
+// there were, e.g. ": 2 errors, 1 5xx", or "" if none
+func (s *stat) unsuccessful() string {
+	var kinds []string
+	for _, k := range []struct {
+		n    int
+		kind string
+	}{
+		{s.Errors, "errors"},
+		{s.Failures, "failures"},
+		{s.Mismatches, "mismatches"},
+		{s.Error4s, "4xx"},
+		{s.Error5s, "5xx"},
+		{s.Redirects, "redirect loops/chains"},
+	} {
+		if k.n > 0 {
+			kinds = append(kinds, fmt.Sprintf("%d %s", k.n, k.kind))
+		}
+	}
+	if len(kinds) == 0 {
+		return ""
+	}
+	return ": " + strings.Join(kinds, ", ")
+}
@@ -0,0 +1,152 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGate(t *testing.T) {
+	tests := []struct {
+		name, spec string
+		want       []gateCond // nil if it fails
+	}{
+		{"latency", "p99<800ms", []gateCond{{Spec: "p99<800ms", Metric: "p99", Op: "<", Value: 800}}},
+		{"fractional percentile", "p99.9<=2s", []gateCond{{Spec: "p99.9<=2s", Metric: "p99.9", Op: "<=", Value: 2000}}},
+		{"min", "min>=1ms", []gateCond{{Spec: "min>=1ms", Metric: "min", Op: ">=", Value: 1}}},
+		{"rate as a percentage", "error_rate<0.1%", []gateCond{{Spec: "error_rate<0.1%", Metric: "error_rate", Op: "<", Value: 0.001}}},
+		{"rate as a fraction", "5xx_rate<=0.05", []gateCond{{Spec: "5xx_rate<=0.05", Metric: "5xx_rate", Op: "<=", Value: 0.05}}},
+		{"count", "count>100", []gateCond{{Spec: "count>100", Metric: "count", Op: ">", Value: 100}}},
+		{"spaces and case", " P50 < 10ms ", []gateCond{{Spec: "P50 < 10ms", Metric: "p50", Op: "<", Value: 10}}},
+		{"several", "p99<1s,4xx<=0,", []gateCond{
+			{Spec: "p99<1s", Metric: "p99", Op: "<", Value: 1000},
+			{Spec: "4xx<=0", Metric: "4xx", Op: "<=", Value: 0},
+		}},
+		{"empty", "", []gateCond{}},
+		{"no comparison", "p99=800ms", nil},
+		{"no value", "p99<", nil},
+		{"latency without a unit", "p99<800", nil},
+		{"bad rate", "error_rate<lots", nil},
+		{"bad count", "errors<=none", nil},
+		{"unknown metric", "p99s<1s", nil},
+		{"percentile out of range", "p101<1s", nil},
+		{"zero percentile", "p0<1s", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseGate(tt.spec)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("parseGate(%q) = %v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGate(%q): %s", tt.spec, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseGate(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseGate(%q)[%d] = %+v, want %+v", tt.spec, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckGate(t *testing.T) {
+	st := &stat{Count: 100, Errors: 1, Error4s: 2, Error5s: 3}
+	for i := 1; i <= 100; i++ {
+		st.Latency.add(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		spec string
+		pass bool
+	}{
+		// The percentiles are within the ~3% of their histogram buckets
+		{"p99<=100ms", true},
+		{"p99<98ms", false},
+		{"p50<=50ms", true},
+		{"avg<50ms", false},
+		{"avg<=50.5ms", true},
+		{"min>=1ms", true},
+		{"max<100ms", false},
+		{"error_rate<=6%", true},
+		{"error_rate<6%", false},
+		{"5xx_rate<0.05", true},
+		{"4xx_rate>0.01", true},
+		{"errors<=6", true},
+		{"errors<6", false},
+		{"unsuccessful<=6", true},
+		{"unsuccessful<6", false},
+		{"4xx<=1", false},
+		{"5xx>=3", true},
+		{"count>=100", true},
+		{"count>100", false},
+		{"p99<1s,4xx<=1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			conds, err := parseGate(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := st.checkGate("Gate", conds, newPalette(true)); got != tt.pass {
+				t.Errorf("checkGate(%q) = %v, want %v", tt.spec, got, tt.pass)
+			}
+		})
+	}
+}
+
+func TestParseExitPolicies(t *testing.T) {
+	tests := []struct {
+		name, policies, maxRate string
+		want                    int // Conditions, or -1 if it fails
+	}{
+		{"none", "", "", 0},
+		{"any", "any", "", 1},
+		{"several, with spaces and case", "4XX, 5xx", "", 2},
+		{"max rate", "", "1%", 1},
+		{"both", "any", "0.5%", 2},
+		{"unknown policy", "some", "", -1},
+		{"bad max rate", "", "most", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExitPolicies(tt.policies, tt.maxRate)
+			if tt.want < 0 {
+				if err == nil {
+					t.Errorf("parseExitPolicies(%q, %q) = %v, want an error", tt.policies, tt.maxRate, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseExitPolicies(%q, %q) = %v, want %d conditions", tt.policies, tt.maxRate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsuccessful(t *testing.T) {
+	tests := []struct {
+		name string
+		st   stat
+		want string
+	}{
+		{"none", stat{Count: 10}, ""},
+		{"some", stat{Count: 10, Errors: 2, Error5s: 1}, ": 2 errors, 1 5xx"},
+		{"all", stat{Errors: 1, Failures: 2, Mismatches: 3, Error4s: 4, Error5s: 5, Redirects: 6}, ": 1 errors, 2 failures, 3 mismatches, 4 4xx, 5 5xx, 6 redirect loops/chains"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.st.unsuccessful(); got != tt.want {
+				t.Errorf("unsuccessful() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
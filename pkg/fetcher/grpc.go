@@ -0,0 +1,322 @@
+package fetcher
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// fetcherService is the gRPC Fetcher service of wgetpipe.proto
+type fetcherService interface {
+	Enqueue(grpc.ServerStream) error
+	Results(grpc.ServerStream) error
+}
+
+// grpcFetcher serves the Fetcher service, queueing to the server's input
+type grpcFetcher struct {
+	s                       *server
+	request, queued, result protoreflect.MessageDescriptor
+	resultsRequest          protoreflect.MessageDescriptor
+}
+
+// serveGRPC starts serving the Fetcher service at the address, queueing to s
+func (f *Fetcher) serveGRPC(s *server, addr string) error {
+	fd, err := protodesc.NewFile(fetcherDescriptor(), nil)
+	if err != nil {
+		return fmt.Errorf("could not build gRPC descriptor: %s", err)
+	}
+	// So reflection clients (e.g. grpcurl) can discover it
+	if err := registerFile(fd); err != nil {
+		return fmt.Errorf("could not register gRPC descriptor: %s", err)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on -grpc-listen %s: %s", addr, err)
+	}
+
+	msgs := fd.Messages()
+	g := &grpcFetcher{
+		s:              s,
+		request:        msgs.ByName("Request"),
+		queued:         msgs.ByName("Queued"),
+		resultsRequest: msgs.ByName("ResultsRequest"),
+		result:         msgs.ByName("Result"),
+	}
+	f.streams()
+
+	f.grpcServer = grpc.NewServer()
+	f.grpcServer.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "wgetpipe.Fetcher",
+		HandlerType: (*fetcherService)(nil),
+		Streams: []grpc.StreamDesc{
+			{
+				StreamName:    "Enqueue",
+				Handler:       func(srv any, stream grpc.ServerStream) error { return srv.(fetcherService).Enqueue(stream) },
+				ClientStreams: true,
+			},
+			{
+				StreamName:    "Results",
+				Handler:       func(srv any, stream grpc.ServerStream) error { return srv.(fetcherService).Results(stream) },
+				ServerStreams: true,
+			},
+		},
+		Metadata: "wgetpipe.proto",
+	}, g)
+	reflection.Register(f.grpcServer)
+
+	go func() {
+		f.Logger.Debug("serving gRPC", "addr", addr)
+		if err := f.grpcServer.Serve(l); err != nil {
+			f.Logger.Error("could not serve gRPC", "error", err)
+		}
+	}()
+	return nil
+}
+
+// registerFile registers the file in the global registry, unless a previous
+// run in this process already has. Registering a conflicting file panics, so
+// conflicts (e.g. with an embedder's protos) are returned as errors first
+func registerFile(fd protoreflect.FileDescriptor) error {
+	if have, err := protoregistry.GlobalFiles.FindFileByPath(fd.Path()); err == nil {
+		if proto.Equal(protodesc.ToFileDescriptorProto(have), protodesc.ToFileDescriptorProto(fd)) {
+			return nil
+		}
+		return fmt.Errorf("a different %s is already registered", fd.Path())
+	}
+
+	var names []protoreflect.FullName
+	for i := 0; i < fd.Messages().Len(); i++ {
+		names = append(names, fd.Messages().Get(i).FullName())
+	}
+	for i := 0; i < fd.Enums().Len(); i++ {
+		names = append(names, fd.Enums().Get(i).FullName())
+	}
+	for i := 0; i < fd.Services().Len(); i++ {
+		names = append(names, fd.Services().Get(i).FullName())
+	}
+	for _, name := range names {
+		if d, err := protoregistry.GlobalFiles.FindDescriptorByName(name); err == nil {
+			return fmt.Errorf("%s is already registered by %s", name, d.ParentFile().Path())
+		}
+	}
+	return protoregistry.GlobalFiles.RegisterFile(fd)
+}
+
+// closeGRPC ends the Results streams, and stops the gRPC server, if serving,
+// giving the streams a few seconds to finish
+func (f *Fetcher) closeGRPC() {
+	if f.grpcServer == nil {
+		return
+	}
+	f.resultStreams.close()
+	stopped := make(chan bool)
+	go func() {
+		f.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		f.grpcServer.Stop()
+	}
+}
+
+// Enqueue queues each request as it's received. Receiving stops while the
+// queue is full, so the client is held back by flow control
+func (g *grpcFetcher) Enqueue(stream grpc.ServerStream) error {
+	var n int64
+	for {
+		m := dynamicpb.NewMessage(g.request)
+		if err := stream.RecvMsg(m); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		fields := m.Descriptor().Fields()
+		get := func(name protoreflect.Name) protoreflect.Value { return m.Get(fields.ByName(name)) }
+		req, err := enqueued(jsonRequest{
+			URL:         get("url").String(),
+			Expect:      int(get("expect").Int()),
+			Method:      get("method").String(),
+			Body:        string(get("body").Bytes()),
+			ContentType: get("content_type").String(),
+			Session:     get("session").String(),
+			Priority:    int(get("priority").Int()),
+		})
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err = g.s.queue(req); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		n++
+	}
+
+	reply := dynamicpb.NewMessage(g.queued)
+	reply.Set(g.queued.Fields().ByName("queued"), protoreflect.ValueOfInt64(n))
+	return stream.SendMsg(reply)
+}
+
+// Results streams the results as they're collated, until the run ends
+func (g *grpcFetcher) Results(stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(dynamicpb.NewMessage(g.resultsRequest)); err != nil {
+		return err
+	}
+	sub := g.s.f.resultStreams.subscribe()
+	defer g.s.f.resultStreams.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case r, ok := <-sub.records:
+			if !ok {
+				return nil
+			}
+			if err := stream.SendMsg(g.resultMessage(&r)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// resultMessage returns the Result message of the record
+func (g *grpcFetcher) resultMessage(r *Result) *dynamicpb.Message {
+	m := dynamicpb.NewMessage(g.result)
+	fields := g.result.Fields()
+	set := func(name protoreflect.Name, v protoreflect.Value) { m.Set(fields.ByName(name), v) }
+	set("url", protoreflect.ValueOfString(r.URL))
+	set("code", protoreflect.ValueOfInt32(int32(r.Code)))
+	set("size", protoreflect.ValueOfInt64(r.Size))
+	set("duration_ms", protoreflect.ValueOfFloat64(r.DurationMS))
+	set("expect", protoreflect.ValueOfInt32(int32(r.Expect)))
+	set("error", protoreflect.ValueOfString(r.Error))
+	set("skipped", protoreflect.ValueOfString(r.Skipped))
+	set("unchanged", protoreflect.ValueOfBool(r.Unchanged))
+	set("hash", protoreflect.ValueOfString(r.Hash))
+	set("deduped", protoreflect.ValueOfString(r.Deduped))
+	set("dns_ms", protoreflect.ValueOfFloat64(r.DNSMS))
+	set("connect_ms", protoreflect.ValueOfFloat64(r.ConnectMS))
+	set("tls_ms", protoreflect.ValueOfFloat64(r.TLSMS))
+	set("ttfb_ms", protoreflect.ValueOfFloat64(r.TTFBMS))
+	set("transfer_ms", protoreflect.ValueOfFloat64(r.TransferMS))
+	set("cached", protoreflect.ValueOfBool(r.Cached))
+	set("wire_size", protoreflect.ValueOfInt64(r.WireSize))
+	set("not_saved", protoreflect.ValueOfString(r.NotSaved))
+	if len(r.Annotations) > 0 {
+		a := m.Mutable(fields.ByName("annotations")).Map()
+		for k, v := range r.Annotations {
+			a.Set(protoreflect.ValueOfString(k).MapKey(), protoreflect.ValueOfString(v))
+		}
+	}
+	return m
+}
+
+// fetcherDescriptor returns the descriptor of wgetpipe.proto, built by hand so
+// no generated code is needed
+func fetcherDescriptor() *descriptorpb.FileDescriptorProto {
+	type fieldType = descriptorpb.FieldDescriptorProto_Type
+	const (
+		tString = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		tBytes  = descriptorpb.FieldDescriptorProto_TYPE_BYTES
+		tInt32  = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		tInt64  = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		tDouble = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+		tBool   = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+	)
+	field := func(name string, number int32, typ fieldType) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(number),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+	}
+	message := func(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+	}
+
+	annotations := field("annotations", 16, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	annotations.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	annotations.TypeName = proto.String(".wgetpipe.Result.AnnotationsEntry")
+	entry := message("AnnotationsEntry", field("key", 1, tString), field("value", 2, tString))
+	entry.Options = &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)}
+
+	result := message("Result",
+		field("url", 1, tString),
+		field("code", 2, tInt32),
+		field("size", 3, tInt64),
+		field("duration_ms", 4, tDouble),
+		field("expect", 5, tInt32),
+		field("error", 6, tString),
+		field("skipped", 7, tString),
+		field("unchanged", 8, tBool),
+		field("hash", 9, tString),
+		field("deduped", 10, tString),
+		field("dns_ms", 11, tDouble),
+		field("connect_ms", 12, tDouble),
+		field("tls_ms", 13, tDouble),
+		field("ttfb_ms", 14, tDouble),
+		field("transfer_ms", 15, tDouble),
+		annotations,
+		field("cached", 17, tBool),
+		field("wire_size", 18, tInt64),
+		field("not_saved", 19, tString),
+	)
+	result.NestedType = []*descriptorpb.DescriptorProto{entry}
+
+	request := message("Request",
+		field("url", 1, tString),
+		field("expect", 2, tInt32),
+		field("method", 3, tString),
+		field("body", 4, tBytes),
+		field("content_type", 5, tString),
+		field("session", 7, tString),
+		field("priority", 8, tInt32),
+	)
+	// Was the file to upload, which clients mustn't name
+	request.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{{Start: proto.Int32(6), End: proto.Int32(7)}}
+	request.ReservedName = []string{"file"}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("wgetpipe.proto"),
+		Package: proto.String("wgetpipe"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			request,
+			message("Queued", field("queued", 1, tInt64)),
+			message("ResultsRequest"),
+			result,
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Fetcher"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{
+					Name:            proto.String("Enqueue"),
+					InputType:       proto.String(".wgetpipe.Request"),
+					OutputType:      proto.String(".wgetpipe.Queued"),
+					ClientStreaming: proto.Bool(true),
+				},
+				{
+					Name:            proto.String("Results"),
+					InputType:       proto.String(".wgetpipe.ResultsRequest"),
+					OutputType:      proto.String(".wgetpipe.Result"),
+					ServerStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}
+}
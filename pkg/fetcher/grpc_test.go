@@ -0,0 +1,53 @@
+package fetcher
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"testing"
+)
+
+func TestServeGRPCTwice(t *testing.T) {
+	for run := 1; run <= 2; run++ {
+		f := New()
+		if err := f.serveGRPC(&server{f: f}, "127.0.0.1:0"); err != nil {
+			t.Fatalf("run %d: %s", run, err)
+		}
+		f.closeGRPC()
+	}
+}
+
+func TestServeGRPCConflict(t *testing.T) {
+	saved := protoregistry.GlobalFiles
+	defer func() { protoregistry.GlobalFiles = saved }()
+
+	// Another file claiming the same path
+	samePath := fetcherDescriptor()
+	samePath.Package = nil
+	samePath.MessageType = nil
+	samePath.Service = nil
+	// Another file declaring the same names
+	sameNames := fetcherDescriptor()
+	sameNames.Name = proto.String("theirs.proto")
+
+	for name, conflicting := range map[string]*descriptorpb.FileDescriptorProto{"same path": samePath, "same names": sameNames} {
+		t.Run(name, func(t *testing.T) {
+			fd, err := protodesc.NewFile(conflicting, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			protoregistry.GlobalFiles = new(protoregistry.Files)
+			if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+				t.Fatal(err)
+			}
+
+			f := New()
+			if err := f.serveGRPC(&server{f: f}, "127.0.0.1:0"); err == nil {
+				f.closeGRPC()
+				t.Error("serveGRPC with a conflicting descriptor registered succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// harRecorder collects an entry for every request made, for -har
+type harRecorder struct {
+	lock    sync.Mutex
+	entries []harEntry
+	secrets bool // Whether to keep the values of harSecretHeaders
+}
+
+// harRedacted is the value of the harSecretHeaders in a HAR, unless
+// -har-secrets is set
+const harRedacted = "[REDACTED]"
+
+// harSecretHeaders are the header fields whose values are credentials, which
+// would be given away to whoever the HAR is shared with
+var harSecretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+}
+
+// The HAR 1.2 format (http://www.softwareishard.com/blog/har-12-spec/), as
+// much of it as a fetcher knows. Unknown sizes and timings are -1
+type harLog struct {
+	Log harBody `json:"log"`
+}
+
+type harBody struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	Started  string      `json:"startedDateTime"`
+	Time     float64     `json:"time"`
+	Request  harRequest  `json:"request"`
+	Response harResponse `json:"response"`
+	Cache    struct{}    `json:"cache"`
+	Timings  harTimings  `json:"timings"`
+	Error    string      `json:"_error,omitempty"`
+
+	started time.Time // For sorting the entries, which are added as they finish
+}
+
+type harRequest struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harCookie `json:"cookies"`
+	Headers     []harNV     `json:"headers"`
+	QueryString []harNV     `json:"queryString"`
+	PostData    *harPost    `json:"postData,omitempty"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harPost struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harCookie `json:"cookies"`
+	Headers     []harNV     `json:"headers"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int         `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harNV struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// wroteHeaders holds the header fields as the transport wrote them, including
+// those it adds itself (e.g. User-Agent, Accept-Encoding), of the last
+// request made with a context from withWroteHeaders
+type wroteHeaders struct {
+	lock   sync.Mutex
+	fields []harNV
+}
+
+// withWroteHeaders returns a context that records the header fields written
+// for a request made with it into the returned wroteHeaders
+func withWroteHeaders(ctx context.Context) (context.Context, *wroteHeaders) {
+	w := &wroteHeaders{}
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// A new request, perhaps a redirect, so forget the last one's
+			w.lock.Lock()
+			w.fields = nil
+			w.lock.Unlock()
+		},
+		WroteHeaderField: func(key string, values []string) {
+			w.lock.Lock()
+			for _, v := range values {
+				w.fields = append(w.fields, harNV{key, v})
+			}
+			w.lock.Unlock()
+		},
+	})
+	return ctx, w
+}
+
+// add records the request, made at started with the given method and
+// written header fields, and its result. response is nil if there wasn't
+// one
+func (h *harRecorder) add(started time.Time, method string, wrote *wroteHeaders, uc *urlCode, response *http.Response) {
+	if h == nil {
+		return
+	}
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	e := harEntry{
+		started: started,
+		Started: started.Format(time.RFC3339Nano),
+		Time:    ms(uc.Dur),
+		Request: harRequest{
+			Method:      method,
+			URL:         uc.URL,
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harCookie{},
+			Headers:     []harNV{},
+			QueryString: []harNV{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Response: harResponse{
+			Cookies:     []harCookie{},
+			Headers:     []harNV{},
+			HeadersSize: -1,
+			BodySize:    -1,
+			Content:     harContent{Size: -1},
+		},
+		Timings: harTimings{
+			Blocked: -1,
+			DNS:     harPhase(uc.Phases.DNS),
+			Connect: harPhase(uc.Phases.Connect + uc.Phases.TLS), // Includes ssl, per the spec
+			Send:    0,
+			Wait:    ms(uc.Phases.TTFB),
+			Receive: ms(uc.Phases.Transfer),
+			SSL:     harPhase(uc.Phases.TLS),
+		},
+	}
+	if pu, err := neturl.Parse(uc.URL); err == nil {
+		for name, values := range pu.Query() {
+			for _, v := range values {
+				e.Request.QueryString = append(e.Request.QueryString, harNV{name, v})
+			}
+		}
+	}
+	if uc.Err != nil {
+		e.Error = uc.Err.Error()
+	}
+	if wrote != nil {
+		wrote.lock.Lock()
+		if wrote.fields != nil {
+			e.Request.Headers = wrote.fields
+		}
+		wrote.lock.Unlock()
+	}
+
+	if response != nil {
+		// The last request made, if redirects were followed
+		if r := response.Request; r != nil {
+			e.Request.URL = r.URL.String()
+			e.Request.HTTPVersion = r.Proto
+			if len(e.Request.Headers) == 0 {
+				e.Request.Headers = harHeaders(r.Header)
+			}
+			for _, c := range r.Cookies() {
+				e.Request.Cookies = append(e.Request.Cookies, harCookie{Name: c.Name, Value: c.Value})
+			}
+			if r.ContentLength >= 0 {
+				e.Request.BodySize = r.ContentLength
+			}
+		}
+		e.Response.Status = response.StatusCode
+		e.Response.StatusText = http.StatusText(response.StatusCode)
+		e.Response.HTTPVersion = response.Proto
+		e.Response.Headers = harHeaders(response.Header)
+		for _, c := range response.Cookies() {
+			e.Response.Cookies = append(e.Response.Cookies, harCookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, HTTPOnly: c.HttpOnly, Secure: c.Secure})
+		}
+		e.Response.RedirectURL = response.Header.Get("Location")
+		e.Response.Content = harContent{Size: uc.Size, MimeType: response.Header.Get("Content-Type")}
+		e.Response.BodySize = uc.Size
+	}
+	if !h.secrets {
+		e.Request.Headers = harRedact(e.Request.Headers)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.entries = append(h.entries, e)
+}
+
+// harPhase returns the duration in milliseconds, or -1 if the phase didn't
+// happen, as for a reused connection
+func harPhase(d time.Duration) float64 {
+	if d == 0 {
+		return -1
+	}
+	return ms(d)
+}
+
+// harHeaders returns the headers as HAR name/value pairs
+func harHeaders(header http.Header) []harNV {
+	nvs := []harNV{}
+	for name, values := range header {
+		for _, v := range values {
+			nvs = append(nvs, harNV{name, v})
+		}
+	}
+	return nvs
+}
+
+// harRedact returns the header fields with the values of harSecretHeaders
+// redacted
+func harRedact(nvs []harNV) []harNV {
+	redacted := make([]harNV, len(nvs))
+	for n, nv := range nvs {
+		if harSecretHeaders[http.CanonicalHeaderKey(nv.Name)] {
+			nv.Value = harRedacted
+		}
+		redacted[n] = nv
+	}
+	return redacted
+}
+
+// write writes the entries recorded so far to the file as a HAR, and
+// forgets them, so each -every cycle gets its own
+func (h *harRecorder) write(file string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	version := "(devel)"
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" {
+		version = bi.Main.Version
+	}
+	entries := h.entries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].started.Before(entries[j].started) })
+	hl := harLog{Log: harBody{
+		Version: "1.2",
+		Creator: harCreator{Name: "wgetpipe", Version: version},
+		Entries: entries,
+	}}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&hl); err != nil {
+		out.Close()
+		return err
+	}
+	h.entries = nil
+	return out.Close()
+}
+
+// harSkipHeaders are the header fields not replayed from a HAR by -from-har:
+// those of the connection, which the transport sets itself, and
+// Accept-Encoding, so bodies are still decoded as usual
+var harSkipHeaders = map[string]bool{
+	"Host":              true,
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Proxy-Connection":  true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Te":                true,
+	"Content-Length":    true,
+	"Accept-Encoding":   true,
+}
+
+// readHAR returns the requests of the entries of the HAR file, in the order
+// they were made, with their method, URL, header fields (but those redacted),
+// and body
+func readHAR(file string) ([]getRequest, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var hl harLog
+	if err := json.Unmarshal(b, &hl); err != nil {
+		return nil, err
+	}
+
+	entries := hl.Log.Entries
+	for n := range entries {
+		entries[n].started, _ = time.Parse(time.RFC3339Nano, entries[n].Started)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].started.Before(entries[j].started) })
+
+	reqs := make([]getRequest, 0, len(entries))
+	for _, e := range entries {
+		req := getRequest{URL: e.Request.URL, Method: strings.ToUpper(e.Request.Method), Header: make(http.Header)}
+		for _, nv := range e.Request.Headers {
+			// HTTP/2 pseudo-headers (e.g. :authority) start with a colon
+			name := http.CanonicalHeaderKey(nv.Name)
+			if strings.HasPrefix(name, ":") || harSkipHeaders[name] || (harSecretHeaders[name] && nv.Value == harRedacted) {
+				continue
+			}
+			req.Header.Add(name, nv.Value)
+		}
+		if p := e.Request.PostData; p != nil && p.Text != "" {
+			req.Body = []byte(p.Text)
+			req.ContentType = p.MimeType
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// scanHAR takes a HAR file, and a sender to send its requests to, and does
+// so, returning false if it was aborted before then
+func (f *Fetcher) scanHAR(file string, s *sender) bool {
+	reqs, err := readHAR(file)
+	if err != nil {
+		f.Logger.Error("could not read -from-har", "file", file, "error", err)
+		return true
+	}
+	for n, req := range reqs {
+		if err := f.validURL(req.URL); err != nil {
+			// e.g. data: URLs
+			f.Logger.Debug("scanner skipping HAR entry", "file", file, "entry", n+1, "error", err)
+			continue
+		}
+		if !s.send(req) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package fetcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHARRedactsCredentials(t *testing.T) {
+	fields := []harNV{
+		{"Authorization", "Bearer secret"},
+		{"proxy-authorization", "Basic c2VjcmV0"},
+		{"User-Agent", "wgetpipe"},
+	}
+	for _, secrets := range []bool{false, true} {
+		h := &harRecorder{secrets: secrets}
+		wrote := &wroteHeaders{fields: append([]harNV(nil), fields...)}
+		h.add(time.Now(), "", wrote, &urlCode{URL: "http://example.com/"}, nil)
+
+		got := h.entries[0].Request.Headers
+		for n, nv := range got {
+			want := fields[n].Value
+			if !secrets && nv.Name != "User-Agent" {
+				want = harRedacted
+			}
+			if nv.Value != want {
+				t.Errorf("with secrets %v, %s is %q, want %q", secrets, nv.Name, nv.Value, want)
+			}
+		}
+		if wrote.fields[0].Value != fields[0].Value {
+			t.Errorf("with secrets %v, the written fields were redacted in place", secrets)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package fetcher
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// histSubBits is the log2 of the number of linear buckets each power of two
+// of microseconds is split into, so a percentile is within ~3% of the truth
+const histSubBits = 5
+
+// histSub is the number of linear buckets in each power of two
+const histSub = 1 << histSubBits
+
+// histogram is a log-linear histogram of latencies, in fixed buckets of
+// microseconds, so percentiles are read from the counts of the buckets
+// rather than by keeping and sorting every latency. The count, sum, min, and
+// max are exact
+type histogram struct {
+	Count    int
+	Sum      time.Duration
+	Min, Max time.Duration
+	buckets  []int // Counts, by bucket, up to the highest used
+}
+
+// histBucket returns the bucket of the duration: a microsecond each up to
+// 2*histSub, then histSub buckets for each power of two
+func histBucket(d time.Duration) int {
+	us := uint64(max(d/time.Microsecond, 0))
+	if us < histSub {
+		return int(us)
+	}
+	shift := bits.Len64(us) - histSubBits - 1
+	return (shift+1)<<histSubBits + int(us>>shift) - histSub
+}
+
+// histValue returns the middle of the bucket
+func histValue(b int) time.Duration {
+	if b < histSub {
+		return time.Duration(b) * time.Microsecond
+	}
+	shift := b>>histSubBits - 1
+	low := uint64(b&(histSub-1)+histSub) << shift
+	return time.Duration(low+(uint64(1)<<shift)/2) * time.Microsecond
+}
+
+// add counts the duration into the histogram
+func (h *histogram) add(d time.Duration) {
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+
+	b := histBucket(d)
+	if b >= len(h.buckets) {
+		h.buckets = append(h.buckets, make([]int, b+1-len(h.buckets))...)
+	}
+	h.buckets[b]++
+}
+
+// mean returns the mean of the durations
+func (h *histogram) mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// percentile returns the p'th percentile (0 < p <= 100) of the durations,
+// by nearest rank, as the middle of its bucket
+func (h *histogram) percentile(p float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := max(int(math.Ceil(p/100*float64(h.Count))), 1)
+	var seen int
+	for b, n := range h.buckets {
+		if seen += n; seen >= rank {
+			return min(max(histValue(b), h.Min), h.Max)
+		}
+	}
+	return h.Max
+}
+
+// percentiles returns the p50, p90, p99, and max of the durations, formatted
+func (h *histogram) percentiles() string {
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s", h.percentile(50), h.percentile(90), h.percentile(99), h.Max)
+}
@@ -0,0 +1,48 @@
+package fetcher
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	var ds []time.Duration
+	r := rand.New(rand.NewSource(1))
+	for range 10000 {
+		// Spread over several powers of two, from microseconds to seconds
+		d := time.Duration(r.ExpFloat64() * float64(50*time.Millisecond))
+		h.add(d)
+		ds = append(ds, d)
+	}
+	slices.Sort(ds)
+
+	if h.Count != len(ds) || h.Min != ds[0] || h.Max != ds[len(ds)-1] {
+		t.Errorf("count, min, max = %d, %s, %s, want %d, %s, %s", h.Count, h.Min, h.Max, len(ds), ds[0], ds[len(ds)-1])
+	}
+	for _, p := range []float64{1, 50, 90, 99, 99.9, 100} {
+		want := ds[max(int(float64(len(ds))*p/100+0.999999)-1, 0)]
+		got := h.percentile(p)
+		// Within the bucket: 1/histSub of its power of two, or a microsecond
+		if diff := (got - want).Abs(); diff > want/histSub+time.Microsecond {
+			t.Errorf("percentile(%g) = %s, want %s (±%s)", p, got, want, want/histSub)
+		}
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	// The buckets are contiguous, and each value is in the bucket of its middle
+	prev := -1
+	for us := time.Duration(0); us < 1<<20; us++ {
+		b := histBucket(us * time.Microsecond)
+		if b != prev && b != prev+1 {
+			t.Fatalf("histBucket(%dµs) = %d, after %d", us, b, prev)
+		}
+		prev = b
+		if got := histBucket(histValue(b)); got != b {
+			t.Fatalf("histBucket(histValue(%d)) = %d", b, got)
+		}
+	}
+}
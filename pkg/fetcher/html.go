@@ -0,0 +1,72 @@
+package fetcher
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// isHTML returns true if the Content-Type is HTML
+func isHTML(contentType string) bool {
+	return strings.Contains(contentType, "text/html") || strings.Contains(contentType, "application/xhtml")
+}
+
+// rewriteLinks takes an HTML body, and calls rewrite for the value of every
+// href or src attribute in it, replacing the value if rewrite returns true.
+// The rewritten body is returned, along with whether anything was rewritten.
+// Everything but the rewritten tags is passed through byte-for-byte
+func rewriteLinks(body []byte, rewrite func(string) (string, bool)) ([]byte, bool, error) {
+	var (
+		out     bytes.Buffer
+		changed bool
+	)
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return body, false, z.Err()
+		}
+
+		raw := append([]byte(nil), z.Raw()...)
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			t := z.Token()
+			modified := false
+			for i, a := range t.Attr {
+				if a.Key != "href" && a.Key != "src" {
+					continue
+				}
+				if v, ok := rewrite(a.Val); ok {
+					t.Attr[i].Val = v
+					modified = true
+				}
+			}
+			if modified {
+				out.WriteString(t.String())
+				changed = true
+				continue
+			}
+		}
+		out.Write(raw)
+	}
+	return out.Bytes(), changed, nil
+}
+
+// resolveLink resolves the link against the base URL, returning the
+// absolute URL sans fragment, and the fragment
+func resolveLink(base *url.URL, link string) (*url.URL, string, error) {
+	u, err := base.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return nil, "", err
+	}
+	frag := u.Fragment
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u, frag, nil
+}
@@ -0,0 +1,344 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fromCacheHeader is set on responses answered from the httpCache without
+// touching the network
+const fromCacheHeader = "X-From-Cache"
+
+// cacheableCodes are the status codes cacheable by default (RFC 7231 6.1)
+var cacheableCodes = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// httpCache is a private HTTP cache (RFC 7234) of GET responses, kept in a
+// directory one file per URL, for -http-cache
+type httpCache struct {
+	dir string
+	log *slog.Logger // Where diagnostics are logged
+}
+
+// cacheMeta is what's kept alongside a cached response
+type cacheMeta struct {
+	URL      string            `json:"url"`
+	StoredAt time.Time         `json:"stored_at"`      // When the response was received
+	Vary     map[string]string `json:"vary,omitempty"` // Request headers named by Vary, and their values
+}
+
+// newHTTPCache returns an httpCache in the dir, creating it if need be
+func newHTTPCache(dir string, log *slog.Logger) (*httpCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &httpCache{dir: dir, log: log}, nil
+}
+
+// path returns the file the URL's response is cached in
+func (h *httpCache) path(u string) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%x.http", sha256.Sum256([]byte(u))))
+}
+
+// load returns the cached response to the request, and its meta, or nil if
+// there isn't one, or it varies from the request
+func (h *httpCache) load(req *http.Request) (*http.Response, *cacheMeta) {
+	u := req.URL.String()
+	b, err := os.ReadFile(h.path(u))
+	if err != nil {
+		return nil, nil
+	}
+	br := bufio.NewReader(bytes.NewReader(b))
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return nil, nil
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(line, &meta); err != nil || meta.URL != u {
+		return nil, nil
+	}
+	for name, value := range meta.Vary {
+		if req.Header.Get(name) != value {
+			return nil, nil
+		}
+	}
+	response, err := http.ReadResponse(br, req)
+	if err != nil {
+		h.log.Warn("could not read -http-cache entry", "url", u, "error", err)
+		return nil, nil
+	}
+	return response, &meta
+}
+
+// store caches the response to the request, whose body is body, received
+// at storedAt
+func (h *httpCache) store(req *http.Request, response *http.Response, body []byte, storedAt time.Time) {
+	u := req.URL.String()
+	meta := cacheMeta{URL: u, StoredAt: storedAt}
+	for _, v := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if meta.Vary == nil {
+					meta.Vary = make(map[string]string)
+				}
+				meta.Vary[name] = req.Header.Get(name)
+			}
+		}
+	}
+	mb, err := json.Marshal(meta)
+	if err != nil {
+		h.log.Error("could not encode -http-cache entry", "url", u, "error", err)
+		return
+	}
+
+	// Dump a copy with the body already read, so its length is known
+	stored := *response
+	stored.Header = response.Header.Clone()
+	stored.Header.Del(fromCacheHeader)
+	stored.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	stored.ContentLength = int64(len(body))
+	stored.TransferEncoding = nil
+	stored.Body = io.NopCloser(bytes.NewReader(body))
+	dump, err := httputil.DumpResponse(&stored, true)
+	if err != nil {
+		h.log.Error("could not encode -http-cache entry", "url", u, "error", err)
+		return
+	}
+
+	// Getters may store the same URL at once, so each writes its own
+	// temporary file, and the last rename wins
+	file := h.path(u)
+	tmp, err := os.CreateTemp(h.dir, filepath.Base(file)+".*.tmp")
+	if err != nil {
+		h.log.Error("could not write -http-cache entry", "url", u, "error", err)
+		return
+	}
+	_, err = tmp.Write(append(append(mb, '\n'), dump...))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		h.log.Error("could not write -http-cache entry", "url", u, "error", err)
+	}
+}
+
+// cacheControl returns the directives of the Cache-Control header, with
+// their values, if any
+func cacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// seconds returns the directive's value as a duration, and whether it had one
+func seconds(cc map[string]string, directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// freshness returns how long the response is fresh for after it was
+// generated (RFC 7234 4.2.1), and its age now (4.2.3)
+func freshness(response *http.Response, storedAt time.Time) (lifetime, age time.Duration) {
+	cc := cacheControl(response.Header)
+	date, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		date = storedAt
+	}
+
+	if d, ok := seconds(cc, "max-age"); ok {
+		lifetime = d
+	} else if v := response.Header.Get("Expires"); v != "" {
+		// Invalid dates, e.g. "0", are already expired
+		if expires, err := http.ParseTime(v); err == nil {
+			lifetime = expires.Sub(date)
+		}
+	} else if lm, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil && date.After(lm) {
+		// The heuristic of 10% of the time since it was modified (4.2.2)
+		lifetime = date.Sub(lm) / 10
+	}
+
+	age = storedAt.Sub(date)
+	if age < 0 {
+		age = 0
+	}
+	if v, err := strconv.ParseInt(response.Header.Get("Age"), 10, 64); err == nil && time.Duration(v)*time.Second > age {
+		age = time.Duration(v) * time.Second
+	}
+	age += time.Since(storedAt)
+	return lifetime, age
+}
+
+// fresh returns whether the cached response may be used for the request
+// without revalidating it
+func fresh(req *http.Request, response *http.Response, storedAt time.Time) bool {
+	reqCC := cacheControl(req.Header)
+	respCC := cacheControl(response.Header)
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+
+	lifetime, age := freshness(response, storedAt)
+	if d, ok := seconds(reqCC, "max-age"); ok && age > d {
+		return false
+	}
+	if d, ok := seconds(reqCC, "min-fresh"); ok {
+		age += d
+	}
+	if age < lifetime {
+		return true
+	}
+	if _, ok := respCC["must-revalidate"]; ok {
+		return false
+	}
+	if v, ok := reqCC["max-stale"]; ok {
+		if v == "" {
+			return true
+		}
+		if d, ok := seconds(reqCC, "max-stale"); ok {
+			return age-lifetime <= d
+		}
+	}
+	return false
+}
+
+// cacheable returns whether the response to the request may be stored
+func cacheable(req *http.Request, response *http.Response) bool {
+	if req.Method != http.MethodGet || !cacheableCodes[response.StatusCode] {
+		return false
+	}
+	if _, ok := cacheControl(req.Header)["no-store"]; ok {
+		return false
+	}
+	respCC := cacheControl(response.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	for _, v := range response.Header.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return false
+		}
+	}
+	// Worth keeping if it's fresh for a while, or can be revalidated
+	_, maxAge := respCC["max-age"]
+	return maxAge || response.Header.Get("Expires") != "" || response.Header.Get("Last-Modified") != "" || response.Header.Get("ETag") != ""
+}
+
+// cacheTransport is an http.RoundTripper that answers GETs from the
+// httpCache while they are fresh, revalidates them once stale, and stores
+// the cacheable responses it gets
+type cacheTransport struct {
+	cache *httpCache
+	rt    http.RoundTripper
+}
+
+// RoundTrip answers the request from the cache, or round-trips it
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests already conditional or ranged are the caller's business
+	if req.Method != http.MethodGet || req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" || req.Header.Get("Range") != "" {
+		return t.rt.RoundTrip(req)
+	}
+
+	cached, meta := t.cache.load(req)
+	if cached != nil {
+		if fresh(req, cached, meta.StoredAt) {
+			cached.Header.Set(fromCacheHeader, "1")
+			return cached, nil
+		}
+
+		// Revalidate it, if it can be
+		etag, lm := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || lm != "" {
+			creq := req.Clone(req.Context())
+			if etag != "" {
+				creq.Header.Set("If-None-Match", etag)
+			}
+			if lm != "" {
+				creq.Header.Set("If-Modified-Since", lm)
+			}
+			response, err := t.rt.RoundTrip(creq)
+			if err != nil {
+				cached.Body.Close()
+				return nil, err
+			}
+			if response.StatusCode != http.StatusNotModified {
+				cached.Body.Close()
+				return t.store(req, response)
+			}
+
+			// Still good, so update its headers from the 304 (4.3.4)
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+			for name, values := range response.Header {
+				if name != "Content-Length" {
+					cached.Header[name] = values
+				}
+			}
+			body, err := io.ReadAll(cached.Body)
+			cached.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			t.cache.store(req, cached, body, time.Now())
+			cached.Body = io.NopCloser(bytes.NewReader(body))
+			return cached, nil
+		}
+		cached.Body.Close()
+	}
+
+	response, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.store(req, response)
+}
+
+// store caches the response to the request if it's cacheable, returning it
+// with its body intact
+func (t *cacheTransport) store(req *http.Request, response *http.Response) (*http.Response, error) {
+	if !cacheable(req, response) {
+		return response, nil
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	t.cache.store(req, response, body, time.Now())
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
@@ -0,0 +1,137 @@
+package fetcher
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// cachedResponse returns a response with the status code and headers, given
+// as name-value pairs, generated at date
+func cachedResponse(code int, date time.Time, headers ...string) *http.Response {
+	r := &http.Response{StatusCode: code, Header: make(http.Header)}
+	r.Header.Set("Date", date.UTC().Format(http.TimeFormat))
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Add(headers[i], headers[i+1])
+	}
+	return r
+}
+
+// cacheRequest returns a GET request with the Cache-Control header, if set
+func cacheRequest(method, cc string) *http.Request {
+	req, _ := http.NewRequest(method, "http://example.com/", nil)
+	if cc != "" {
+		req.Header.Set("Cache-Control", cc)
+	}
+	return req
+}
+
+func TestFreshness(t *testing.T) {
+	// HTTP dates are to the second
+	now := time.Now().Truncate(time.Second)
+	tests := []struct {
+		name          string
+		storedAgo     time.Duration // Stored and generated this long ago
+		headers       []string
+		lifetime, age time.Duration
+	}{
+		{"max-age", 0, []string{"Cache-Control", "max-age=60"}, time.Minute, 0},
+		{"max-age, quoted", 0, []string{"Cache-Control", `public, max-age="60"`}, time.Minute, 0},
+		{"max-age over Expires", 0, []string{"Cache-Control", "max-age=60", "Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat)}, time.Minute, 0},
+		{"Expires", 0, []string{"Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat)}, time.Hour, 0},
+		{"invalid Expires", 0, []string{"Expires", "0"}, 0, 0},
+		{"negative max-age ignored", 0, []string{"Cache-Control", "max-age=-1", "Expires", now.Add(time.Hour).UTC().Format(http.TimeFormat)}, time.Hour, 0},
+		{"Last-Modified heuristic", 0, []string{"Last-Modified", now.Add(-10 * time.Hour).UTC().Format(http.TimeFormat)}, time.Hour, 0},
+		{"nothing", 0, nil, 0, 0},
+		{"aged by storage", time.Minute, []string{"Cache-Control", "max-age=600"}, 10 * time.Minute, time.Minute},
+		{"Age header", 0, []string{"Cache-Control", "max-age=600", "Age", "30"}, 10 * time.Minute, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storedAt := now.Add(-tt.storedAgo)
+			lifetime, age := freshness(cachedResponse(200, storedAt, tt.headers...), storedAt)
+			if lifetime != tt.lifetime {
+				t.Errorf("lifetime = %s, want %s", lifetime, tt.lifetime)
+			}
+			// Aging while the test runs
+			if age < tt.age || age > tt.age+time.Second {
+				t.Errorf("age = %s, want %s", age, tt.age)
+			}
+		})
+	}
+}
+
+func TestFreshnessClockSkew(t *testing.T) {
+	// Generated "after" it was stored, by the origin's clock
+	storedAt := time.Now().Truncate(time.Second)
+	_, age := freshness(cachedResponse(200, storedAt.Add(time.Hour), "Cache-Control", "max-age=60"), storedAt)
+	if age > time.Second {
+		t.Errorf("age = %s, want about 0", age)
+	}
+}
+
+func TestFresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		storedAgo time.Duration
+		reqCC     string
+		headers   []string
+		want      bool
+	}{
+		{"within max-age", 0, "", []string{"Cache-Control", "max-age=60"}, true},
+		{"past max-age", 2 * time.Minute, "", []string{"Cache-Control", "max-age=60"}, false},
+		{"no lifetime", 0, "", []string{"ETag", `"x"`}, false},
+		{"response no-cache", 0, "", []string{"Cache-Control", "no-cache, max-age=60"}, false},
+		{"request no-cache", 0, "no-cache", []string{"Cache-Control", "max-age=60"}, false},
+		{"request max-age exceeded", time.Minute, "max-age=30", []string{"Cache-Control", "max-age=600"}, false},
+		{"request max-age met", time.Minute, "max-age=120", []string{"Cache-Control", "max-age=600"}, true},
+		{"request min-fresh unmet", 0, "min-fresh=120", []string{"Cache-Control", "max-age=60"}, false},
+		{"request min-fresh met", 0, "min-fresh=30", []string{"Cache-Control", "max-age=60"}, true},
+		{"stale, max-stale of any", 2 * time.Minute, "max-stale", []string{"Cache-Control", "max-age=60"}, true},
+		{"stale, within max-stale", 2 * time.Minute, "max-stale=120", []string{"Cache-Control", "max-age=60"}, true},
+		{"stale, past max-stale", 2 * time.Minute, "max-stale=30", []string{"Cache-Control", "max-age=60"}, false},
+		{"stale, invalid max-stale", 2 * time.Minute, "max-stale=x", []string{"Cache-Control", "max-age=60"}, false},
+		{"stale, must-revalidate", 2 * time.Minute, "max-stale", []string{"Cache-Control", "max-age=60, must-revalidate"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storedAt := time.Now().Truncate(time.Second).Add(-tt.storedAgo)
+			if got := fresh(cacheRequest(http.MethodGet, tt.reqCC), cachedResponse(200, storedAt, tt.headers...), storedAt); got != tt.want {
+				t.Errorf("fresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		reqCC   string
+		code    int
+		headers []string
+		want    bool
+	}{
+		{"max-age", http.MethodGet, "", 200, []string{"Cache-Control", "max-age=60"}, true},
+		{"Expires", http.MethodGet, "", 200, []string{"Expires", "0"}, true},
+		{"Last-Modified", http.MethodGet, "", 200, []string{"Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT"}, true},
+		{"ETag", http.MethodGet, "", 200, []string{"ETag", `"x"`}, true},
+		{"404 with ETag", http.MethodGet, "", 404, []string{"ETag", `"x"`}, true},
+		{"nothing to go on", http.MethodGet, "", 200, nil, false},
+		{"HEAD", http.MethodHead, "", 200, []string{"Cache-Control", "max-age=60"}, false},
+		{"POST", http.MethodPost, "", 200, []string{"Cache-Control", "max-age=60"}, false},
+		{"partial content", http.MethodGet, "", 206, []string{"Cache-Control", "max-age=60"}, false},
+		{"server error", http.MethodGet, "", 500, []string{"Cache-Control", "max-age=60"}, false},
+		{"request no-store", http.MethodGet, "no-store", 200, []string{"Cache-Control", "max-age=60"}, false},
+		{"response no-store", http.MethodGet, "", 200, []string{"Cache-Control", "max-age=60, No-Store"}, false},
+		{"Vary *", http.MethodGet, "", 200, []string{"Cache-Control", "max-age=60", "Vary", "*"}, false},
+		{"Vary header", http.MethodGet, "", 200, []string{"Cache-Control", "max-age=60", "Vary", "Accept-Encoding"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cacheable(cacheRequest(tt.method, tt.reqCC), cachedResponse(tt.code, time.Now(), tt.headers...)); got != tt.want {
+				t.Errorf("cacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,615 @@
+package fetcher
+
+import (
+	"github.com/cheggaaa/pb/v3"
+	"golang.org/x/net/idna"
+
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// jsonRequest is a line of -input json
+type jsonRequest struct {
+	URL         string `json:"url"`
+	Expect      int    `json:"expect,omitempty"`
+	Method      string `json:"method,omitempty"`
+	Body        string `json:"body,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	File        string `json:"file,omitempty"`
+	Session     string `json:"session,omitempty"`
+	Priority    int    `json:"priority,omitempty"`
+}
+
+// carryColumn is a column of -input csv or tsv rows to carry through to the
+// output, for -carry-cols
+type carryColumn struct {
+	Name  string // As output
+	Index int    // From 1
+}
+
+// parseCarryColumns parses a comma-separated list of column numbers, each
+// optionally named (e.g. "2,owner=5"), else named "colN"
+func parseCarryColumns(s string) ([]carryColumn, error) {
+	var cols []carryColumn
+	for _, c := range strings.Split(s, ",") {
+		name, num, named := strings.Cut(strings.TrimSpace(c), "=")
+		if !named {
+			num = name
+			name = "col" + num
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("'%s' is not a column number, from 1", num)
+		}
+		cols = append(cols, carryColumn{Name: name, Index: n})
+	}
+	return cols, nil
+}
+
+// parseRow parses the line as a row of -input csv or tsv
+func (f *Fetcher) parseRow(line string) ([]string, error) {
+	r := csv.NewReader(strings.NewReader(line))
+	if f.InputFormat == "tsv" {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	return r.Read()
+}
+
+// parseLine takes a line of input, and returns the getRequest for it, per the
+// InputFormat. "text" lines are a URL, optionally followed by a TAB and the
+// expected HTTP status code for it. In PutMode, the URL is instead followed by
+// a TAB and the file to upload to it, optionally followed by a TAB and the
+// expected code. "json" lines are a jsonRequest object. "csv" and "tsv" lines
+// are rows with the URL in the URLColumn, and any CarryColumns are carried
+func (f *Fetcher) parseLine(line string) (getRequest, error) {
+	var req getRequest
+
+	switch f.InputFormat {
+	case "csv", "tsv":
+		row, err := f.parseRow(line)
+		if err != nil {
+			return req, fmt.Errorf("invalid %s row: %w", strings.ToUpper(f.InputFormat), err)
+		}
+		if f.URLColumn > len(row) {
+			return req, fmt.Errorf("no column %d (-url-col) in a row of %d", f.URLColumn, len(row))
+		}
+		req.URL = strings.TrimSpace(row[f.URLColumn-1])
+		for _, c := range f.CarryColumns {
+			v := ""
+			if c.Index <= len(row) {
+				v = row[c.Index-1]
+			}
+			req.Carried = append(req.Carried, v)
+		}
+	case "json":
+		var jr jsonRequest
+		if err := json.Unmarshal([]byte(line), &jr); err != nil {
+			return req, fmt.Errorf("invalid JSON request: %w", err)
+		}
+		req.URL = jr.URL
+		req.Expect = jr.Expect
+		req.Method = strings.ToUpper(jr.Method)
+		req.ContentType = jr.ContentType
+		req.File = jr.File
+		req.Session = jr.Session
+		req.Priority = jr.Priority
+		if jr.Body != "" {
+			req.Body = []byte(jr.Body)
+		}
+	default:
+		u, expect, _ := strings.Cut(line, "\t")
+		req.URL = u
+		if f.PutMode {
+			req.File, expect, _ = strings.Cut(expect, "\t")
+			if req.File == "" {
+				return req, fmt.Errorf("no file to upload for '%s'", u)
+			}
+		}
+		if expect = strings.TrimSpace(expect); expect != "" {
+			code, err := strconv.Atoi(expect)
+			if err != nil {
+				return req, fmt.Errorf("invalid expected code '%s': %w", expect, err)
+			}
+			req.Expect = code
+		}
+	}
+	return req, nil
+}
+
+// openInputs takes a list of input filenames, where "-" is STDIN,
+// and returns them opened
+func openInputs(names []string) ([]io.ReadCloser, error) {
+	inputs := make([]io.ReadCloser, 0, len(names))
+	for _, name := range names {
+		if name == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			for _, i := range inputs {
+				i.Close()
+			}
+			return nil, err
+		}
+		inputs = append(inputs, f)
+	}
+	return inputs, nil
+}
+
+// inputStat holds the tallies of the input
+// inputStat is updated and read atomically, as the stats may be
+// asked for while the input is still being read
+type inputStat struct {
+	Duplicates int64 // URLs dropped by -dedupe
+	Filtered   int64 // URLs dropped by -match or -exclude
+	Completed  int64 // URLs dropped by -state, as completed by a previous run
+	Invalid    int64 // Lines dropped as malformed
+}
+
+// sender sends requests to the getters, normalizing their URLs on the way
+type sender struct {
+	f       *Fetcher        // Whose settings to send by
+	ctx     context.Context // Cancelled to abort
+	getChan chan getRequest
+	bar     *pb.ProgressBar
+	count   int64
+	lines   int64           // Input lines read, for -skip
+	seen    map[string]bool // URLs already sent, for -dedupe
+}
+
+// send normalizes the request URL and sends it to the getters, returning
+// false if we have been aborted or drained, or have sent MaxURLs
+func (s *sender) send(req getRequest) bool {
+	if s.ctx.Err() != nil {
+		s.f.Logger.Debug("scanner abort seen")
+		return false
+	}
+	if s.f.draining.Load() {
+		s.f.Logger.Debug("scanner drain seen")
+		return false
+	}
+	s.f.Logger.Debug("scanner sending")
+
+	line := req.URL
+	if l, err := idnaURL(line); err != nil {
+		s.f.Logger.Debug("scanner could not convert hostname", "url", line, "error", err)
+	} else if l != line {
+		s.f.Logger.Debug("scanner converted hostname", "url", line, "to", l)
+		line = l
+	}
+	if s.f.LenientURLs {
+		if l := lenientURL(line); l != line {
+			s.f.Logger.Debug("scanner normalized", "url", line, "to", l)
+			line = l
+		}
+	}
+
+	if s.f.Normalize {
+		if l, err := normalizeURL(line, s.f.SortQuery); err != nil {
+			s.f.Logger.Debug("scanner could not normalize", "url", line, "error", err)
+		} else if l != line {
+			s.f.Logger.Debug("scanner normalized", "url", line, "to", l)
+			line = l
+		}
+	}
+
+	req.URL = line
+	if (s.f.MatchURLs != nil && !s.f.MatchURLs.MatchString(line)) || (s.f.ExcludeURLs != nil && s.f.ExcludeURLs.MatchString(line)) {
+		s.f.Logger.Debug("scanner filtering", "url", line)
+		atomic.AddInt64(&s.f.inputStats.Filtered, 1)
+		req.ack(true)
+		return true
+	}
+	if s.f.completed[line] {
+		s.f.Logger.Debug("scanner skipping previously-completed", "url", line)
+		atomic.AddInt64(&s.f.inputStats.Completed, 1)
+		req.ack(true)
+		return true
+	}
+	if s.f.Dedupe {
+		if s.seen[line] {
+			s.f.Logger.Debug("scanner skipping duplicate", "url", line)
+			atomic.AddInt64(&s.f.inputStats.Duplicates, 1)
+			req.ack(true)
+			return true
+		}
+		s.seen[line] = true
+	}
+	if s.f.sample != nil && !s.f.sample.keep(req) {
+		s.f.Logger.Debug("scanner sampling out, or holding back for -sample", "url", line)
+		return true
+	}
+	return s.dispatch(req)
+}
+
+// dispatch sends the already-normalized request to the getters, returning
+// false once we have sent MaxURLs, or if ctx is cancelled first
+func (s *sender) dispatch(req getRequest) bool {
+	line := req.URL
+	if !s.f.frontier.visit(line) {
+		s.f.Logger.Debug("scanner skipping already-visited", "url", line)
+		req.ack(true)
+		return true
+	}
+	s.f.frontier.sending()
+	select {
+	case s.getChan <- req:
+	case <-s.ctx.Done():
+		s.f.Logger.Debug("scanner abort seen")
+		s.f.frontier.finished()
+		s.f.unfetched.add(req)
+		return false
+	}
+	s.count++
+	if s.bar != nil {
+		if s.bar.Total() < s.count {
+			s.bar.SetTotal(s.bar.Total() + 1)
+		}
+	}
+	if s.f.MaxURLs > 0 && s.count >= s.f.MaxURLs {
+		s.f.Logger.Debug("scanner sent -n URLs, stopping", "count", s.count)
+		return false
+	}
+	return true
+}
+
+// scanInputs takes a list of inputs and sitemap URLs, and a channel to pass
+// inputted requests to, and does so until EOF of each input in turn, then from
+// any queue source until interrupted, then of each FromResults file, then of each FromHAR file, then for each sitemap, whereafter it calls inputDone
+// (which should eventually close the channel). It stops early if ctx is
+// cancelled. See parseLine for the line formats
+func (f *Fetcher) scanInputs(ctx context.Context, inputs []io.ReadCloser, sitemaps []string, getChan chan getRequest, bar *pb.ProgressBar, inputDone func()) {
+	defer inputDone()
+	defer func() {
+		for _, i := range inputs {
+			i.Close()
+		}
+	}()
+
+	s := &sender{
+		f:       f,
+		ctx:     ctx,
+		getChan: getChan,
+		bar:     bar,
+		seen:    make(map[string]bool),
+	}
+	for _, input := range inputs {
+		if !f.scanInput(input, s) {
+			return
+		}
+	}
+	if f.source != nil && !f.scanSource(f.source, s) {
+		return
+	}
+
+	results, err := openInputs(f.FromResults)
+	if err != nil {
+		f.Logger.Error("could not open -from-results", "error", err)
+	}
+	for n, input := range results {
+		ok := f.scanResults(input, s)
+		input.Close()
+		if !ok {
+			for _, rest := range results[n+1:] {
+				rest.Close()
+			}
+			return
+		}
+	}
+
+	for _, file := range f.FromHAR {
+		if !f.scanHAR(file, s) {
+			return
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, sm := range sitemaps {
+		if err := f.scanSitemap(sm, seen, s); err == errAborted {
+			return
+		} else if err != nil {
+			f.Logger.Error("could not read sitemap", "url", sm, "error", err)
+		}
+	}
+	if f.sample != nil {
+		for _, req := range f.sample.flush() {
+			if ctx.Err() != nil {
+				f.Logger.Debug("scanner abort seen")
+				return
+			}
+			if f.draining.Load() {
+				return
+			}
+			if !s.dispatch(req) {
+				return
+			}
+		}
+	}
+
+	// POST: we've seen EOF
+	f.Logger.Debug("EOF seen", "sent", s.count)
+}
+
+// maxLineLength is the longest line of input read, well beyond any sane URL or
+// JSON request, but not so long that a runaway input is all held in memory
+const maxLineLength = 1024 * 1024
+
+// lineSplitter splits input into lines as bufio.ScanLines does, but skips
+// those longer than maxLineLength instead of giving up on the rest of the input
+type lineSplitter struct {
+	skipping bool // Whether the rest of a long line is being skipped
+	tooLong  bool // Whether the last (empty) token was a skipped long line
+}
+
+// split is the bufio.SplitFunc of the lineSplitter
+func (l *lineSplitter) split(data []byte, atEOF bool) (int, []byte, error) {
+	l.tooLong = false
+	if l.skipping {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			l.skipping, l.tooLong = false, true
+			return i + 1, []byte{}, nil
+		} else if atEOF {
+			l.skipping, l.tooLong = false, true
+			return len(data), []byte{}, nil
+		}
+		return len(data), nil, nil
+	}
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	if advance == 0 && token == nil && err == nil && len(data) >= maxLineLength {
+		// The buffer is full without a line in it
+		l.skipping = true
+		return len(data), nil, nil
+	}
+	return advance, token, err
+}
+
+// scanInput takes an input, and a sender to send inputted requests to, and
+// does so until EOF, returning false if it was aborted before then. Malformed
+// lines are logged with their line number, and counted, but otherwise skipped
+func (f *Fetcher) scanInput(input io.Reader, s *sender) bool {
+	name := "input"
+	if n, ok := input.(interface{ Name() string }); ok {
+		name = n.Name()
+	}
+	var lineNo int64
+	invalid := func(err error) {
+		f.Logger.Warn("skipping invalid input line", "input", name, "line", lineNo, "error", err)
+		atomic.AddInt64(&f.inputStats.Invalid, 1)
+	}
+
+	var lines lineSplitter
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	scanner.Split(lines.split)
+	for scanner.Scan() {
+		lineNo++
+		s.lines++
+		if lines.tooLong {
+			invalid(fmt.Errorf("longer than %d bytes", maxLineLength))
+			continue
+		}
+		if s.lines <= f.SkipLines || f.ignorable(scanner.Text()) {
+			continue
+		}
+		req, err := f.parseLine(scanner.Text())
+		if err != nil {
+			invalid(err)
+			continue
+		}
+
+		if f.Expand {
+			sent := true
+			err := expandURL(req.URL, func(u string) bool {
+				if err := f.validURL(u); err != nil {
+					invalid(err)
+					return true
+				}
+				r := req
+				r.URL = u
+				sent = s.send(r)
+				return sent
+			})
+			if err != nil {
+				invalid(fmt.Errorf("could not expand: %w", err))
+				continue
+			}
+			if !sent {
+				return false
+			}
+			continue
+		}
+
+		if err := f.validURL(req.URL); err != nil {
+			invalid(err)
+			continue
+		}
+		if !s.send(req) {
+			return false
+		}
+	}
+	// Draining closes the inputs, so reading them fails
+	if err := scanner.Err(); err != nil && !f.draining.Load() {
+		f.Logger.Error("could not read input", "error", err)
+	}
+	return true
+}
+
+// ignorable returns true if -allow-comments is set, and the line of input is
+// blank, or a # comment
+func (f *Fetcher) ignorable(line string) bool {
+	line = strings.TrimSpace(line)
+	return f.AllowComments && (line == "" || strings.HasPrefix(line, "#"))
+}
+
+// validURL returns why the input URL isn't an absolute URL with a host (or a
+// file:// URL) that could be requested, if it isn't
+func (f *Fetcher) validURL(raw string) error {
+	if f.LenientURLs {
+		raw = lenientURL(raw)
+	}
+	if strings.TrimSpace(raw) == "" {
+		return fmt.Errorf("no URL")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("'%s' is not a URL: %w", raw, err)
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("'%s' is not an absolute URL", raw)
+	}
+	if u.Host == "" && u.Scheme != "file" {
+		return fmt.Errorf("'%s' has no host", raw)
+	}
+	return nil
+}
+
+// lenientURL takes a raw input line and percent-encodes any characters
+// after the authority that are illegal in a URL (spaces, control characters,
+// non-ASCII, stray '%', etc.), returning the normalized form
+func lenientURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+
+	// Leave the scheme and authority alone
+	_, start := authority(raw)
+
+	var b strings.Builder
+	b.WriteString(raw[:start])
+	for i := start; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '%':
+			if i+2 < len(raw) && isHex(raw[i+1]) && isHex(raw[i+2]) {
+				// Already encoded
+				b.WriteByte(c)
+			} else {
+				b.WriteString("%25")
+			}
+		case c <= ' ' || c >= 0x7f || strings.IndexByte(`"<>\^`+"`"+`{|}`, c) >= 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// authority returns the start and end offsets of the authority
+// (userinfo, host and port) portion of the raw URL. If there is
+// no authority, both offsets are 0
+func authority(raw string) (int, int) {
+	i := strings.Index(raw, "://")
+	if i < 0 {
+		return 0, 0
+	}
+	start := i + 3
+	if j := strings.IndexAny(raw[start:], "/?#"); j >= 0 {
+		return start, start + j
+	}
+	return start, len(raw)
+}
+
+// idnaURL takes a raw URL and converts any Unicode hostname in it to
+// its ASCII (punycode) form, leaving the rest of the URL as-is
+func idnaURL(raw string) (string, error) {
+	start, end := authority(raw)
+	host := raw[start:end]
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		// Skip the userinfo
+		start += i + 1
+		host = host[i+1:]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+		// Skip the port
+		host = host[:i]
+	}
+
+	ascii := true
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return raw, nil
+	}
+
+	h, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return raw, err
+	}
+	return raw[:start] + h + raw[start+len(host):], nil
+}
+
+// displayURL takes a URL, and if its hostname is punycode, returns
+// the URL followed by the Unicode form of the hostname for readability
+func displayURL(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || !strings.Contains(pu.Hostname(), "xn--") {
+		return u
+	}
+	h, err := idna.ToUnicode(pu.Hostname())
+	if err != nil || h == pu.Hostname() {
+		return u
+	}
+	return fmt.Sprintf("%s [%s]", u, h)
+}
+
+// normalizeURL takes a raw URL, and returns its normalized form: lowercase
+// scheme and host, no default port or fragment, no dot segments in the path,
+// and, if sortQuery, its query parameters sorted
+func normalizeURL(raw string, sortQuery bool) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw, err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return raw, fmt.Errorf("not an absolute URL")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+u.Port())
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	if u.Path == "" {
+		u.Path = "/"
+	} else {
+		// Resolving against itself removes dot segments
+		u = u.ResolveReference(&url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery, ForceQuery: u.ForceQuery})
+	}
+
+	if sortQuery && u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.Strings(params)
+		u.RawQuery = strings.Join(params, "&")
+	}
+	return u.String(), nil
+}
+
+// isHex returns true if the byte is a hexadecimal digit
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
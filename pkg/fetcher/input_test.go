@@ -0,0 +1,82 @@
+package fetcher
+
+import (
+	"testing"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name, url string
+		sortQuery bool
+		want      string // "" if it fails
+	}{
+		{"already normal", "http://example.com/a", false, "http://example.com/a"},
+		{"case", "HTTP://Example.COM/Path", false, "http://example.com/Path"},
+		{"default http port", "http://example.com:80/a", false, "http://example.com/a"},
+		{"default https port", "https://example.com:443/a", false, "https://example.com/a"},
+		{"other port", "http://example.com:443/a", false, "http://example.com:443/a"},
+		{"fragment", "http://example.com/a#top", false, "http://example.com/a"},
+		{"no path", "http://example.com", false, "http://example.com/"},
+		{"no path, query", "http://example.com?a=1", false, "http://example.com/?a=1"},
+		{"dot segments", "http://example.com/a/./b/../c", false, "http://example.com/a/c"},
+		{"dot segments above root", "http://example.com/../../a", false, "http://example.com/a"},
+		{"trailing dot segment", "http://example.com/a/b/..", false, "http://example.com/a/"},
+		{"encoded slash", "http://example.com/a%2Fb/../c", false, "http://example.com/c"},
+		{"encoded characters", "http://example.com/a%20b", false, "http://example.com/a%20b"},
+		{"query kept in order", "http://example.com/?b=2&a=1", false, "http://example.com/?b=2&a=1"},
+		{"query sorted", "http://example.com/?b=2&a=1&a=0", true, "http://example.com/?a=0&a=1&b=2"},
+		{"empty query", "http://example.com/a?", true, "http://example.com/a?"},
+		{"userinfo case kept", "http://User@Example.com/", false, "http://User@example.com/"},
+		{"IPv6", "http://[::1]:80/a", false, "http://[::1]/a"},
+		{"relative", "/a/b", false, ""},
+		{"no host", "http:///a", false, ""},
+		{"unparseable", "http://example.com/%zz", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeURL(tt.url, tt.sortQuery)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("normalizeURL(%q) = %q, want an error", tt.url, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeURL(%q): %s", tt.url, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLenientURL(t *testing.T) {
+	tests := []struct {
+		name, url, want string
+	}{
+		{"legal", "http://example.com/a?b=c#d", "http://example.com/a?b=c#d"},
+		{"surrounding space", "  http://example.com/a \t", "http://example.com/a"},
+		{"space", "http://example.com/a b", "http://example.com/a%20b"},
+		{"already encoded", "http://example.com/a%20b", "http://example.com/a%20b"},
+		{"lowercase hex kept", "http://example.com/a%2fb", "http://example.com/a%2fb"},
+		{"stray percent", "http://example.com/100%", "http://example.com/100%25"},
+		{"percent without two hex digits", "http://example.com/a%4", "http://example.com/a%254"},
+		{"percent with non-hex", "http://example.com/a%zz", "http://example.com/a%25zz"},
+		{"illegal characters", "http://example.com/\"<>\\^`{|}", "http://example.com/%22%3C%3E%5C%5E%60%7B%7C%7D"},
+		{"control character", "http://example.com/a\x01b", "http://example.com/a%01b"},
+		{"DEL", "http://example.com/a\x7f", "http://example.com/a%7F"},
+		{"non-ASCII", "http://example.com/café", "http://example.com/caf%C3%A9"},
+		{"in query", "http://example.com/?q=a b", "http://example.com/?q=a%20b"},
+		{"authority left alone", "http://us er@exa mple.com/a b", "http://us er@exa mple.com/a%20b"},
+		{"authority only", "http://example.com", "http://example.com"},
+		{"no scheme", "example.com/a b", "example.com/a%20b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lenientURL(tt.url); got != tt.want {
+				t.Errorf("lenientURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package fetcher
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseJitter parses a jitter percentage, e.g. "20%", into a fraction
+func parseJitter(s string) (float64, error) {
+	p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 100 {
+		return 0, fmt.Errorf("'%s' is not between 0%% and 100%%", s)
+	}
+	return p / 100, nil
+}
+
+// jitter returns the duration randomly varied by up to the Jitter fraction
+// either way, so schedules don't synchronize
+func (f *Fetcher) jitter(d time.Duration) time.Duration {
+	if f.Jitter == 0 || d <= 0 {
+		return d
+	}
+	return d + time.Duration((rand.Float64()*2-1)*f.Jitter*float64(d))
+}
@@ -0,0 +1,156 @@
+package fetcher
+
+import (
+	"github.com/segmentio/kafka-go"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kafkaQueue is a queueSource of input lines from the values of the messages
+// of a Kafka topic, consumed in a consumer group so multiple wgetpipes can
+// share it. Each partition's offset is committed up to the oldest message
+// without a result, so those in flight when a consumer dies are redelivered
+type kafkaQueue struct {
+	f      *Fetcher // Whose InputFormat the messages are in
+	reader *kafka.Reader
+
+	lock       sync.Mutex
+	partitions map[int]*kafkaPartition
+}
+
+// kafkaPartition tracks the messages of a partition that are being fetched
+type kafkaPartition struct {
+	pending []kafka.Message // Returned by next, in offset order
+	acked   map[int64]bool  // Offsets of pending messages with results
+}
+
+// newKafkaQueue returns a kafkaQueue for f of the topic on the brokers,
+// consumed in the group
+func newKafkaQueue(f *Fetcher, brokers []string, topic, group string) (*kafkaQueue, error) {
+	if group == "" {
+		return nil, errors.New("-kafka-group is required with -kafka-in")
+	}
+	return &kafkaQueue{
+		f: f,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        brokers,
+			Topic:          topic,
+			GroupID:        group,
+			CommitInterval: time.Second,
+		}),
+		partitions: make(map[int]*kafkaPartition),
+	}, nil
+}
+
+// next returns the next request from the topic
+func (q *kafkaQueue) next(ctx context.Context) (getRequest, error) {
+	for {
+		msg, err := q.reader.FetchMessage(ctx)
+		if err != nil {
+			return getRequest{}, err
+		}
+		q.fetched(msg)
+		ack := func(bool) { q.ack(msg) }
+
+		line := strings.TrimSpace(string(msg.Value))
+		req, err := q.f.parseLine(line)
+		if err == nil && line == "" {
+			err = errors.New("empty message")
+		}
+		if err != nil {
+			// It won't parse any better next time
+			q.f.Logger.Debug("scanner skipping queued message", "partition", msg.Partition, "offset", msg.Offset, "error", err)
+			ack(false)
+			continue
+		}
+		req.Ack = ack
+		return req, nil
+	}
+}
+
+// fetched records the message as pending
+func (q *kafkaQueue) fetched(msg kafka.Message) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	p := q.partitions[msg.Partition]
+	if p == nil {
+		p = &kafkaPartition{acked: make(map[int64]bool)}
+		q.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg)
+}
+
+// ack records the message as having a result, committing its partition's
+// offset past it and any later messages that have results, unless an earlier
+// one is still pending
+func (q *kafkaQueue) ack(msg kafka.Message) {
+	q.lock.Lock()
+	p := q.partitions[msg.Partition]
+	p.acked[msg.Offset] = true
+	var done *kafka.Message
+	for len(p.pending) > 0 && p.acked[p.pending[0].Offset] {
+		delete(p.acked, p.pending[0].Offset)
+		done = &p.pending[0]
+		p.pending = p.pending[1:]
+	}
+	q.lock.Unlock()
+
+	if done == nil {
+		return
+	}
+	if err := q.reader.CommitMessages(context.Background(), *done); err != nil {
+		q.f.Logger.Error("could not commit to Kafka", "partition", done.Partition, "offset", done.Offset, "error", err)
+	}
+}
+
+// Close leaves the consumer group, committing what's been acknowledged
+func (q *kafkaQueue) Close() error {
+	return q.reader.Close()
+}
+
+// kafkaProducer produces each result to a Kafka topic, as the JSON of its
+// Result keyed by its URL
+type kafkaProducer struct {
+	writer *kafka.Writer
+	log    *slog.Logger // Where diagnostics are logged
+}
+
+// newKafkaProducer returns a kafkaProducer to the topic on the brokers
+func newKafkaProducer(brokers []string, topic string, log *slog.Logger) *kafkaProducer {
+	return &kafkaProducer{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		// So collation isn't held back by each write
+		Async: true,
+		Completion: func(msgs []kafka.Message, err error) {
+			if err != nil {
+				log.Error("could not produce to -kafka-out", "results", len(msgs), "error", err)
+			}
+		},
+	}, log: log}
+}
+
+// result queues the result to be produced
+func (k *kafkaProducer) result(r Result) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		k.log.Error("could not encode result for -kafka-out", "url", r.URL, "error", err)
+		return
+	}
+	if err := k.writer.WriteMessages(context.Background(), kafka.Message{Key: []byte(r.URL), Value: b}); err != nil {
+		k.log.Error("could not produce to -kafka-out", "url", r.URL, "error", err)
+	}
+}
+
+// Close produces any results still queued
+func (k *kafkaProducer) Close() error {
+	return k.writer.Close()
+}
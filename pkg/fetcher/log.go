@@ -0,0 +1,30 @@
+package fetcher
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// defaultLogger returns the Logger of a new Fetcher, of errors to stderr
+func defaultLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// newLogger returns a Logger to w at the level (debug, info, warn, or error),
+// in the format, text or json
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown level '%s'", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown format '%s'", format)
+}
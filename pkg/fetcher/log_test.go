@@ -0,0 +1,36 @@
+package fetcher
+
+import (
+	"github.com/fatih/color"
+
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestConfigureOwnLogger(t *testing.T) {
+	noColor := color.NoColor
+
+	first := New()
+	if err := first.Configure([]string{"-nocolor"}); err != nil {
+		t.Fatal(err)
+	}
+	logger, colors := first.Logger, first.colors
+
+	second := New()
+	if err := second.Configure([]string{"-log-level", "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if first.Logger != logger || first.colors != colors {
+		t.Error("configuring a second Fetcher changed the first's logging or colors")
+	}
+	if first.Logger.Enabled(context.Background(), slog.LevelDebug) || !second.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("-log-level debug wasn't the second Fetcher's alone")
+	}
+	if got := first.colors.red.Sprint("x"); got != "x" {
+		t.Errorf("with -nocolor, red is %q, want it plain", got)
+	}
+	if color.NoColor != noColor {
+		t.Error("-nocolor changed color.NoColor for the whole process")
+	}
+}
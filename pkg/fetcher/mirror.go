@@ -0,0 +1,80 @@
+package fetcher
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// mirrorStat holds the tallies of -verify-mirror
+type mirrorStat struct {
+	Missing   int // Live files not in the mirror
+	Different int // Live files that differ from the mirror
+	Extra     int // Mirror files not seen live
+}
+
+// verifyMirror takes a URL (as it's saved, by saveAs) and its live contents,
+// and compares them to the file saved for it in the VerifyMirror directory, returning a MIRROR-MISSING
+// or MIRROR-DIFFERENT error if it isn't there or isn't the same
+func (f *Fetcher) verifyMirror(rawURL string, contents []byte) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(f.VerifyMirror, savePath(u))
+
+	f.mirrorLock.Lock()
+	f.mirrorChecked[file] = true
+	f.mirrorHosts[filepath.Join(f.VerifyMirror, hostDir(u))] = true
+	f.mirrorLock.Unlock()
+
+	fi, err := os.Stat(file)
+	if os.IsNotExist(err) || (err == nil && !fi.Mode().IsRegular()) {
+		f.mirrorLock.Lock()
+		f.mirrorStats.Missing++
+		f.mirrorLock.Unlock()
+		return fmt.Errorf("MIRROR-MISSING: %s", file)
+	} else if err != nil {
+		return err
+	}
+
+	same, err := sameContents(file, contents)
+	if err != nil {
+		return err
+	} else if !same {
+		f.mirrorLock.Lock()
+		f.mirrorStats.Different++
+		f.mirrorLock.Unlock()
+		return fmt.Errorf("MIRROR-DIFFERENT: %s (mirror %d bytes, live %d bytes)", file, fi.Size(), len(contents))
+	}
+	return nil
+}
+
+// mirrorExtras returns the files in the mirror directories of the hosts
+// checked, that were not themselves checked, sorted
+func (f *Fetcher) mirrorExtras() []string {
+	f.mirrorLock.Lock()
+	defer f.mirrorLock.Unlock()
+
+	var extras []string
+	for host := range f.mirrorHosts {
+		err := filepath.WalkDir(host, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && !f.mirrorChecked[p] {
+				extras = append(extras, p)
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			f.Logger.Error("could not walk mirror", "path", host, "error", err)
+		}
+	}
+	sort.Strings(extras)
+	f.mirrorStats.Extra = len(extras)
+	return extras
+}
@@ -0,0 +1,129 @@
+package fetcher
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// objectSaver is a saver into an S3 bucket (or Cloud Storage, through its
+// S3-compatible API), for -save-to. Objects are named as SaveFile names
+// files, under the prefix
+type objectSaver struct {
+	client  *s3.Client
+	bucket  string
+	prefix  string       // Ending in /, unless empty
+	regions sync.Map     // The bucket's region, if not the configured one
+	log     *slog.Logger // Where diagnostics are logged
+}
+
+// newObjectSaver returns an objectSaver for the s3:// or gs:// URL of a bucket,
+// and optionally a prefix within it
+func newObjectSaver(ctx context.Context, saveTo string, log *slog.Logger) (*objectSaver, error) {
+	u, err := url.Parse(saveTo)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "s3" && u.Scheme != "gs") || u.Host == "" {
+		return nil, fmt.Errorf("'%s' is not an s3://bucket/prefix or gs://bucket/prefix URL", saveTo)
+	}
+	client, err := newS3Client(ctx, nil, u.Scheme == "gs")
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &objectSaver{client: client, bucket: u.Host, prefix: prefix, log: log}, nil
+}
+
+// key returns the name of the URL's object
+func (o *objectSaver) key(u string) (string, error) {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	return o.prefix + strings.TrimPrefix(savePath(pu), "/"), nil
+}
+
+// save puts the contents as the URL's object, unless it's already there with
+// the same contents (its ETag being their MD5)
+func (o *objectSaver) save(u string, contents []byte) (bool, error) {
+	key, err := o.key(u)
+	if err != nil {
+		return false, err
+	}
+	sum := md5.Sum(contents)
+	if o.etag(key) == fmt.Sprintf(`"%x"`, sum) {
+		o.log.Debug("unchanged object", "bucket", o.bucket, "key", key)
+		return false, nil
+	}
+
+	md5sum := base64.StdEncoding.EncodeToString(sum[:])
+	err = inBucketRegion(&o.regions, o.bucket, func(optFns ...func(*s3.Options)) error {
+		_, err := o.client.PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:     &o.bucket,
+			Key:        &key,
+			Body:       bytes.NewReader(contents),
+			ContentMD5: &md5sum,
+		}, optFns...)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	o.log.Debug("saved object", "bucket", o.bucket, "key", key)
+	return true, nil
+}
+
+// copy copies the from URL's object to the to URL's, within the bucket
+func (o *objectSaver) copy(from, to string) (bool, error) {
+	fromKey, err := o.key(from)
+	if err != nil {
+		return false, err
+	}
+	toKey, err := o.key(to)
+	if err != nil {
+		return false, err
+	}
+	if etag := o.etag(toKey); etag != "" && etag == o.etag(fromKey) {
+		return false, nil
+	}
+
+	source := strings.ReplaceAll(url.PathEscape(o.bucket+"/"+fromKey), "%2F", "/")
+	err = inBucketRegion(&o.regions, o.bucket, func(optFns ...func(*s3.Options)) error {
+		_, err := o.client.CopyObject(context.Background(), &s3.CopyObjectInput{
+			Bucket:     &o.bucket,
+			Key:        &toKey,
+			CopySource: &source,
+		}, optFns...)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	o.log.Debug("copied object", "bucket", o.bucket, "from", fromKey, "key", toKey)
+	return true, nil
+}
+
+// etag returns the ETag of the object, or "" if there isn't one
+func (o *objectSaver) etag(key string) string {
+	var etag string
+	inBucketRegion(&o.regions, o.bucket, func(optFns ...func(*s3.Options)) error {
+		out, err := o.client.HeadObject(context.Background(), &s3.HeadObjectInput{Bucket: &o.bucket, Key: &key}, optFns...)
+		if err == nil && out.ETag != nil {
+			etag = *out.ETag
+		}
+		return err
+	})
+	return etag
+}
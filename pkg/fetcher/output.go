@@ -0,0 +1,284 @@
+package fetcher
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultColumns are the CSV columns of a Result, before any annotations
+var resultColumns = []string{"url", "code", "size", "duration_ms", "expect", "error", "skipped", "unchanged", "hash", "deduped",
+	"dns_ms", "connect_ms", "tls_ms", "ttfb_ms", "transfer_ms", "cached", "wire_size", "not_saved"}
+
+// Result is a result as output by -format json or csv, and read back
+// by -from-results
+type Result struct {
+	URL         string            `json:"url"`
+	Code        int               `json:"code"`
+	Size        int64             `json:"size"`
+	DurationMS  float64           `json:"duration_ms"`
+	Expect      int               `json:"expect,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	Skipped     string            `json:"skipped,omitempty"`
+	Unchanged   bool              `json:"unchanged,omitempty"`
+	Hash        string            `json:"hash,omitempty"`
+	Deduped     string            `json:"deduped,omitempty"`
+	DNSMS       float64           `json:"dns_ms"`
+	ConnectMS   float64           `json:"connect_ms"`
+	TLSMS       float64           `json:"tls_ms"`
+	TTFBMS      float64           `json:"ttfb_ms"`
+	TransferMS  float64           `json:"transfer_ms"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Cached      bool              `json:"cached,omitempty"`
+	WireSize    int64             `json:"wire_size,omitempty"`
+	NotSaved    string            `json:"not_saved,omitempty"`
+}
+
+// newRecord returns the Result of the urlCode, with its annotation values
+func (f *Fetcher) newRecord(i *urlCode, values []string) Result {
+	r := Result{
+		URL:        i.URL,
+		Code:       i.Code,
+		Size:       i.Size,
+		DurationMS: ms(i.Dur),
+		Expect:     i.Expect,
+		Skipped:    i.Skipped,
+		Unchanged:  i.Unchanged,
+		Hash:       i.Hash,
+		Deduped:    i.Deduped,
+		DNSMS:      ms(i.Phases.DNS),
+		ConnectMS:  ms(i.Phases.Connect),
+		TLSMS:      ms(i.Phases.TLS),
+		TTFBMS:     ms(i.Phases.TTFB),
+		TransferMS: ms(i.Phases.Transfer),
+		Cached:     i.Cached,
+		WireSize:   i.WireSize,
+		NotSaved:   i.NotSaved,
+	}
+	switch {
+	case i.Err != nil:
+		r.Error = i.Err.Error()
+	case i.Expect != 0 && i.Code != i.Expect:
+		r.Error = fmt.Sprintf("expected %d", i.Expect)
+	case i.Fail != nil:
+		r.Error = i.Fail.Error()
+	}
+	if f.annotations != nil && values != nil {
+		r.Annotations = make(map[string]string)
+		for n, col := range f.annotations.Columns {
+			r.Annotations[col] = values[n]
+		}
+	}
+	return r
+}
+
+// resultWriter writes resultRecords in the OutputFormat
+type resultWriter struct {
+	csv     *csv.Writer
+	json    *json.Encoder
+	columns []string // Annotation columns, output after the resultColumns
+}
+
+// newResultWriter returns a resultWriter to w for the format, "json" or "csv",
+// having written the header if there is one
+func (f *Fetcher) newResultWriter(w io.Writer, format string) *resultWriter {
+	if format == "json" {
+		return &resultWriter{json: json.NewEncoder(w)}
+	}
+
+	rw := &resultWriter{csv: csv.NewWriter(w)}
+	header := resultColumns
+	if f.annotations != nil {
+		rw.columns = f.annotations.Columns
+		header = append(append([]string{}, resultColumns...), rw.columns...)
+	}
+	rw.csv.Write(header)
+	rw.csv.Flush()
+	return rw
+}
+
+// write writes the record
+func (w *resultWriter) write(r Result) {
+	if w.json != nil {
+		w.json.Encode(r)
+		return
+	}
+
+	row := []string{
+		r.URL,
+		strconv.Itoa(r.Code),
+		strconv.FormatInt(r.Size, 10),
+		msString(r.DurationMS),
+		strconv.Itoa(r.Expect),
+		r.Error,
+		r.Skipped,
+		strconv.FormatBool(r.Unchanged),
+		r.Hash,
+		r.Deduped,
+		msString(r.DNSMS),
+		msString(r.ConnectMS),
+		msString(r.TLSMS),
+		msString(r.TTFBMS),
+		msString(r.TransferMS),
+		strconv.FormatBool(r.Cached),
+		strconv.FormatInt(r.WireSize, 10),
+		r.NotSaved,
+	}
+	for _, col := range w.columns {
+		row = append(row, r.Annotations[col])
+	}
+	w.csv.Write(row)
+	w.csv.Flush()
+}
+
+// ms returns the duration in fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// msString returns the milliseconds formatted for CSV
+func msString(ms float64) string {
+	return strconv.FormatFloat(ms, 'f', 3, 64)
+}
+
+// codeRanges is a list of HTTP status code ranges, e.g. for -only-codes
+type codeRanges [][2]int
+
+// parseCodeRanges parses a comma-delimited list of codes and code ranges,
+// e.g. "0,404,500-599"
+func parseCodeRanges(s string) (codeRanges, error) {
+	var cr codeRanges
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		lo, hi, isRange := strings.Cut(part, "-")
+		l, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid code '%s'", part)
+		}
+		h := l
+		if isRange {
+			if h, err = strconv.Atoi(hi); err != nil || h < l {
+				return nil, fmt.Errorf("invalid code range '%s'", part)
+			}
+		}
+		cr = append(cr, [2]int{l, h})
+	}
+	return cr, nil
+}
+
+// match returns true if the code is in any of the ranges, or there are none
+func (cr codeRanges) match(code int) bool {
+	if len(cr) == 0 {
+		return true
+	}
+	for _, r := range cr {
+		if r[0] <= code && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// scanResults takes the output of a previous run, in JSON or CSV, and a
+// sender to send the requests of its results matching OnlyCodes to, and does
+// so until EOF, returning false if it was aborted before then
+func (f *Fetcher) scanResults(input io.Reader, s *sender) bool {
+	return readResults(input, f.Logger, func(r Result) bool {
+		return f.sendResult(r, s)
+	})
+}
+
+// readResults takes the output of a previous run, in JSON or CSV, and calls
+// fn with each of its results until EOF, returning false if fn did
+func readResults(input io.Reader, log *slog.Logger, fn func(Result) bool) bool {
+	br := bufio.NewReader(input)
+	if first, err := br.Peek(1); err != nil {
+		return true
+	} else if first[0] == '{' {
+		return readJSONResults(br, log, fn)
+	}
+	return readCSVResults(br, log, fn)
+}
+
+// readJSONResults is readResults for -format json output
+func readJSONResults(input io.Reader, log *slog.Logger, fn func(Result) bool) bool {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		var r Result
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// e.g. -stats lines
+			log.Debug("scanner skipping result", "error", err)
+			continue
+		}
+		if !fn(r) {
+			return false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Error("could not read results", "error", err)
+	}
+	return true
+}
+
+// readCSVResults is readResults for -format csv output
+func readCSVResults(input io.Reader, log *slog.Logger, fn func(Result) bool) bool {
+	r := csv.NewReader(input)
+	r.FieldsPerRecord = -1
+	cols := make(map[string]int)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return true
+		} else if err != nil {
+			log.Debug("scanner skipping result", "error", err)
+			continue
+		}
+		if len(cols) == 0 {
+			// The header
+			for n, col := range row {
+				cols[col] = n
+			}
+			if _, ok := cols["url"]; !ok {
+				log.Error("could not read results: no url column")
+				return true
+			}
+			continue
+		}
+
+		field := func(col string) string {
+			if n, ok := cols[col]; ok && n < len(row) {
+				return row[n]
+			}
+			return ""
+		}
+		var rec Result
+		rec.URL = field("url")
+		rec.Code, _ = strconv.Atoi(field("code"))
+		rec.Size, _ = strconv.ParseInt(field("size"), 10, 64)
+		rec.Expect, _ = strconv.Atoi(field("expect"))
+		rec.Skipped = field("skipped")
+		rec.Hash = field("hash")
+		if !strings.Contains(rec.URL, "://") {
+			// e.g. -stats lines
+			continue
+		}
+		if !fn(rec) {
+			return false
+		}
+	}
+}
+
+// sendResult sends the request for the result, if it matches OnlyCodes,
+// returning false if we have been aborted
+func (f *Fetcher) sendResult(r Result, s *sender) bool {
+	if r.Skipped != "" || !f.OnlyCodes.match(r.Code) {
+		return true
+	}
+	return s.send(getRequest{URL: r.URL, Expect: r.Expect})
+}
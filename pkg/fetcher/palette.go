@@ -0,0 +1,29 @@
+package fetcher
+
+import (
+	"github.com/fatih/color"
+)
+
+// palette is the colors of a Fetcher's output, which -nocolor turns off for
+// that Fetcher alone, rather than with color.NoColor for the whole process
+type palette struct {
+	red, green, yellow, cyan, magenta *color.Color
+}
+
+// newPalette returns a palette, colorless if noColor is set
+func newPalette(noColor bool) *palette {
+	c := func(a color.Attribute) *color.Color {
+		c := color.New(a)
+		if noColor {
+			c.DisableColor()
+		}
+		return c
+	}
+	return &palette{
+		red:     c(color.FgRed),
+		green:   c(color.FgGreen),
+		yellow:  c(color.FgYellow),
+		cyan:    c(color.FgCyan),
+		magenta: c(color.FgMagenta),
+	}
+}
@@ -0,0 +1,86 @@
+package fetcher
+
+import (
+	"sync"
+)
+
+// pauser pauses and resumes the getters pulling requests
+type pauser struct {
+	lock    sync.Mutex
+	resume  chan bool // Closed when resumed, nil if not paused
+	running chan bool // Always closed
+}
+
+// newPauser returns an unpaused pauser
+func newPauser() *pauser {
+	p := &pauser{running: make(chan bool)}
+	close(p.running)
+	return p
+}
+
+// toggle pauses if running, else resumes, returning whether it's now paused
+func (p *pauser) toggle() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resume != nil {
+		close(p.resume)
+		p.resume = nil
+		return false
+	}
+	p.resume = make(chan bool)
+	return true
+}
+
+// set pauses or resumes, returning whether that changed anything
+func (p *pauser) set(paused bool) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if (p.resume != nil) == paused {
+		return false
+	}
+	if paused {
+		p.resume = make(chan bool)
+	} else {
+		close(p.resume)
+		p.resume = nil
+	}
+	return true
+}
+
+// paused returns whether the getters are paused
+func (p *pauser) paused() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.resume != nil
+}
+
+// resumed returns a channel that is closed once not paused
+func (p *pauser) resumed() <-chan bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.resume != nil {
+		return p.resume
+	}
+	return p.running
+}
+
+// togglePause pauses or resumes the getters, saying so
+func (f *Fetcher) togglePause() {
+	f.announcePause(f.pause.toggle())
+}
+
+// setPause pauses or resumes the getters, saying so if that changed anything
+func (f *Fetcher) setPause(paused bool) {
+	if f.pause.set(paused) {
+		f.announcePause(paused)
+	}
+}
+
+// announcePause says the getters have been paused or resumed
+func (f *Fetcher) announcePause(paused bool) {
+	if paused {
+		f.colors.cyan.Printf("PAUSED: in-flight requests will finish, but no more will be made until resumed (by SIGUSR1, or the -control resume command)\n")
+	} else {
+		f.colors.cyan.Printf("RESUMED\n")
+	}
+}
@@ -0,0 +1,115 @@
+package fetcher
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// workerPool runs the getters, and may be resized while they run. Excess
+// getters retire once they finish their current request
+type workerPool struct {
+	lock     sync.Mutex
+	spawn    func(*workerPool) // Starts a getter in the pool
+	size     int               // Getters wanted
+	running  int               // Getters running
+	retiring int               // Getters running that have been told to retire
+	wake     chan bool         // Closed to wake idle getters, to retire if in excess
+	closed   bool              // Whether all the getters are done
+	done     chan bool         // Closed once all the getters are done
+}
+
+// newWorkerPool returns a workerPool of getters, started with spawn
+func newWorkerPool(spawn func(*workerPool)) *workerPool {
+	return &workerPool{
+		spawn: spawn,
+		wake:  make(chan bool),
+		done:  make(chan bool),
+	}
+}
+
+// resize starts or retires getters until n (at least 1) are running. If
+// they are all done, n is only kept, for the next -every cycle to start with
+func (p *workerPool) resize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.size = n
+	if p.closed {
+		return
+	}
+	for p.running-p.retiring < p.size {
+		p.running++
+		go p.spawn(p)
+	}
+	close(p.wake)
+	p.wake = make(chan bool)
+}
+
+// Size returns the number of getters wanted
+func (p *workerPool) Size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.size
+}
+
+// woken returns a channel that is closed when the pool is resized
+func (p *workerPool) woken() <-chan bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.wake
+}
+
+// retire returns true if the calling getter is in excess, and so must retire
+func (p *workerPool) retire() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.running-p.retiring > p.size {
+		p.retiring++
+		return true
+	}
+	return false
+}
+
+// finished must be called by each getter as it returns, with whether it
+// retired
+func (p *workerPool) finished(retired bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running--
+	if retired {
+		p.retiring--
+	}
+	if p.running == 0 {
+		p.closed = true
+		close(p.done)
+	}
+}
+
+// resizeFromFile resizes the workers to the number in the MaxFile
+func (f *Fetcher) resizeFromFile() {
+	if f.MaxFile == "" {
+		f.Logger.Warn("not resizing: -max-file is not set")
+		return
+	}
+	b, err := os.ReadFile(f.MaxFile)
+	if err != nil {
+		f.Logger.Error("could not read -max-file", "error", err)
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || n < 1 {
+		f.Logger.Error("could not read -max-file: not a positive number", "value", strings.TrimSpace(string(b)))
+		return
+	}
+	pool := f.workers.Load()
+	if pool == nil {
+		f.Logger.Warn("not resizing: no getters are running yet")
+		return
+	}
+	pool.resize(n)
+	f.colors.cyan.Printf("RESIZED: %d getters\n", n)
+}
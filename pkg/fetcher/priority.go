@@ -0,0 +1,118 @@
+package fetcher
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// prioritized is a request in a priorityQueue
+type prioritized struct {
+	req getRequest
+	seq int64 // Order of arrival, so equal priorities are first-come first-served
+}
+
+// requestHeap is a container/heap of prioritized requests, highest priority first
+type requestHeap []prioritized
+
+func (h requestHeap) Len() int { return len(h) }
+func (h requestHeap) Less(i, j int) bool {
+	if h[i].req.Priority != h[j].req.Priority {
+		return h[i].req.Priority > h[j].req.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h requestHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *requestHeap) Push(x any)   { *h = append(*h, x.(prioritized)) }
+func (h *requestHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// priorityQueue reorders the requests from an input channel by priority,
+// holding up to size of them, and feeds them to an output channel
+type priorityQueue struct {
+	lock sync.Mutex
+	heap requestHeap
+	seq  int64
+	size int
+}
+
+// newPriorityQueue returns a priorityQueue holding up to size requests
+func newPriorityQueue(size int) *priorityQueue {
+	return &priorityQueue{size: size}
+}
+
+// Len returns the number of requests held
+func (q *priorityQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.heap)
+}
+
+// run feeds the requests from in to out, highest priority first, until in is
+// closed (or drainChan is, taking only what's already buffered in in) and all
+// have been fed, whereafter out is closed, or until ctx is cancelled
+func (q *priorityQueue) run(ctx context.Context, in <-chan getRequest, out chan<- getRequest, drainChan <-chan bool) {
+	for {
+		var (
+			next   getRequest
+			feed   chan<- getRequest // nil, so not selected, unless there's a next
+			intake = in              // nil, so not selected, if full or closed
+		)
+		q.lock.Lock()
+		if len(q.heap) > 0 {
+			next = q.heap[0].req
+			feed = out
+		}
+		if len(q.heap) >= q.size {
+			intake = nil
+		}
+		q.lock.Unlock()
+		if in == nil && feed == nil {
+			close(out)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-drainChan:
+			// The scanner may be blocked reading, so stop waiting on it
+			drainChan = nil
+			q.lock.Lock()
+			for len(in) > 0 {
+				heap.Push(&q.heap, prioritized{req: <-in, seq: q.seq})
+				q.seq++
+			}
+			q.lock.Unlock()
+			in = nil
+		case req, ok := <-intake:
+			if !ok {
+				in = nil
+				continue
+			}
+			q.lock.Lock()
+			heap.Push(&q.heap, prioritized{req: req, seq: q.seq})
+			q.seq++
+			q.lock.Unlock()
+		case feed <- next:
+			q.lock.Lock()
+			heap.Pop(&q.heap)
+			q.lock.Unlock()
+		}
+	}
+}
+
+// drain empties the queue, returning the requests it held
+func (q *priorityQueue) drain() []getRequest {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	reqs := make([]getRequest, 0, len(q.heap))
+	for len(q.heap) > 0 {
+		reqs = append(reqs, heap.Pop(&q.heap).(prioritized).req)
+	}
+	return reqs
+}
@@ -0,0 +1,103 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// builtinProfiles are the curated -profile bundles of flag defaults. They may
+// be overridden, or added to, by profiles of the same name in the -profiles file
+var builtinProfiles = map[string]map[string]string{
+	"mirror": {
+		"save":       "true",
+		"errorsonly": "true",
+		"stats":      "true",
+	},
+	"audit": {
+		"errorsonly": "true",
+		"stats":      "true",
+		"timeout":    "30s",
+	},
+	"bench": {
+		"bar":   "true",
+		"stats": "true",
+		"max":   "20",
+	},
+	"monitor": {
+		"errorsonly": "true",
+		"stats":      "true",
+		"nocolor":    "true",
+		"timeout":    "10s",
+	},
+}
+
+// defaultProfilesFile returns the path of the default profiles file,
+// ~/.wgetpipe-profiles.json
+func defaultProfilesFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".wgetpipe-profiles.json")
+}
+
+// loadProfiles returns the builtinProfiles, overlaid with any in the
+// specified JSON file of the form {"name": {"flag": "value", ...}, ...}.
+// A missing file is not an error.
+func loadProfiles(file string) (map[string]map[string]string, error) {
+	profiles := make(map[string]map[string]string, len(builtinProfiles))
+	for name, p := range builtinProfiles {
+		profiles[name] = p
+	}
+	if file == "" {
+		return profiles, nil
+	}
+
+	b, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var fp map[string]map[string]string
+	if err := json.Unmarshal(b, &fp); err != nil {
+		return nil, fmt.Errorf("error parsing profiles file '%s': %w", file, err)
+	}
+	for name, p := range fp {
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// applyProfile sets the flags from the named profile, unless they were
+// explicitly set on the command line
+func (f *Fetcher) applyProfile(name, file string) error {
+	profiles, err := loadProfiles(file)
+	if err != nil {
+		return err
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s'", name)
+	}
+
+	set := make(map[string]bool)
+	f.flags.Visit(func(fl *flag.Flag) {
+		set[fl.Name] = true
+	})
+
+	for k, v := range p {
+		if set[k] || k == "profile" || k == "profiles" {
+			continue
+		}
+		if err := f.flags.Set(k, v); err != nil {
+			return fmt.Errorf("profile '%s' has bad value '%s' for '%s': %w", name, v, k, err)
+		}
+		f.Logger.Debug("profile set flag", "profile", name, "flag", k, "value", v)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// proxyAuth authenticates to a proxy with Basic auth, or with Digest
+// auth once the proxy has issued a Digest challenge
+type proxyAuth struct {
+	user string
+	pass string
+	log  *slog.Logger // Where diagnostics are logged
+
+	lock      sync.Mutex
+	challenge map[string]string // The Digest challenge parameters, if any
+	nc        int               // Nonce count for the challenge
+	gen       int               // Incremented with each new challenge
+}
+
+// newProxyAuth returns a proxyAuth for the userinfo, or nil if there is none
+func newProxyAuth(user *url.Userinfo, log *slog.Logger) *proxyAuth {
+	if user == nil {
+		return nil
+	}
+	pass, _ := user.Password()
+	return &proxyAuth{user: user.Username(), pass: pass, log: log}
+}
+
+// generation returns a number that changes every time a new challenge is seen
+func (p *proxyAuth) generation() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.gen
+}
+
+// challenged takes the headers of a 407 response, and stores any Digest
+// challenge in them, returning true if there was one
+func (p *proxyAuth) challenged(h http.Header) bool {
+	for _, v := range h.Values("Proxy-Authenticate") {
+		scheme, params, _ := strings.Cut(v, " ")
+		if !strings.EqualFold(scheme, "Digest") {
+			continue
+		}
+		p.lock.Lock()
+		p.challenge = parseAuthParams(params)
+		p.nc = 0
+		p.gen++
+		p.lock.Unlock()
+		p.log.Debug("proxy issued Digest challenge", "realm", p.challenge["realm"])
+		return true
+	}
+	return false
+}
+
+// header returns the Proxy-Authorization header value for a request with the
+// method and URI: Digest if a challenge has been seen, else Basic
+func (p *proxyAuth) header(method, uri string) string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.challenge == nil {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(p.user+":"+p.pass))
+	}
+
+	c := p.challenge
+	var h func() hash.Hash
+	algorithm := c["algorithm"]
+	switch strings.ToUpper(algorithm) {
+	case "SHA-256":
+		h = sha256.New
+	default:
+		h = md5.New
+		algorithm = "MD5"
+	}
+	hexHash := func(s string) string {
+		hh := h()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	ha1 := hexHash(p.user + ":" + c["realm"] + ":" + p.pass)
+	ha2 := hexHash(method + ":" + uri)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s`, p.user, c["realm"], c["nonce"], uri, algorithm)
+	if qop := c["qop"]; qop != "" {
+		// We only support "auth"
+		p.nc++
+		nc := fmt.Sprintf("%08x", p.nc)
+		cnonce := make([]byte, 8)
+		rand.Read(cnonce)
+		cn := hex.EncodeToString(cnonce)
+		fmt.Fprintf(&b, `, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cn, hexHash(ha1+":"+c["nonce"]+":"+nc+":"+cn+":auth:"+ha2))
+	} else {
+		fmt.Fprintf(&b, `, response="%s"`, hexHash(ha1+":"+c["nonce"]+":"+ha2))
+	}
+	if opaque, ok := c["opaque"]; ok {
+		fmt.Fprintf(&b, `, opaque="%s"`, opaque)
+	}
+	return b.String()
+}
+
+// parseAuthParams parses comma-delimited key=value authentication parameters,
+// where values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return params
+		}
+		k, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return params
+		}
+		k = strings.ToLower(strings.TrimSpace(k))
+
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				b.WriteByte(rest[i])
+			}
+			v = b.String()
+			s = rest[min(i+1, len(rest)):]
+		} else {
+			v, s, _ = strings.Cut(rest, ",")
+			v = strings.TrimSpace(v)
+		}
+		params[k] = v
+	}
+}
+
+// proxyAuthTransport is an http.RoundTripper that authenticates requests to
+// a proxy, retrying once when the proxy issues a new Digest challenge
+type proxyAuthTransport struct {
+	base *http.Transport
+	auth *proxyAuth
+}
+
+// setProxy configures the Transport to use the proxy, returning an http.RoundTripper
+// that authenticates to it with any credentials in the proxy URL
+func setProxy(t *http.Transport, proxy *url.URL, log *slog.Logger) http.RoundTripper {
+	auth := newProxyAuth(proxy.User, log)
+
+	// We do the authentication ourselves, so Digest is possible
+	pu := *proxy
+	pu.User = nil
+	t.Proxy = http.ProxyURL(&pu)
+
+	// Record CONNECT tunnel timings, authenticated or not
+	t.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		if connectRes.StatusCode == http.StatusOK {
+			timingFrom(ctx).tunnelled()
+		}
+		return nil
+	}
+	if auth == nil {
+		return t
+	}
+
+	t.GetProxyConnectHeader = func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+		return http.Header{"Proxy-Authorization": []string{auth.header(http.MethodConnect, target)}}, nil
+	}
+	t.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, connectReq *http.Request, connectRes *http.Response) error {
+		if connectRes.StatusCode == http.StatusProxyAuthRequired {
+			auth.challenged(connectRes.Header)
+		} else if connectRes.StatusCode == http.StatusOK {
+			timingFrom(ctx).tunnelled()
+		}
+		return nil
+	}
+	return &proxyAuthTransport{base: t, auth: auth}
+}
+
+// RoundTrip sends the request via the proxy, authenticating to it
+func (p *proxyAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		gen := p.auth.generation()
+
+		r := req
+		if attempt > 0 || req.URL.Scheme == "http" {
+			r = req.Clone(req.Context())
+			if attempt > 0 && req.Body != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+		if req.URL.Scheme == "http" {
+			// Proxied directly, rather than via CONNECT
+			r.Header.Set("Proxy-Authorization", p.auth.header(req.Method, req.URL.String()))
+		}
+
+		response, err := p.base.RoundTrip(r)
+		if attempt > 0 || (req.Body != nil && req.GetBody == nil) {
+			// Can't, or won't, retry
+			return response, err
+		}
+		if err == nil && response.StatusCode == http.StatusProxyAuthRequired && req.URL.Scheme == "http" && p.auth.challenged(response.Header) {
+			response.Body.Close()
+			continue
+		}
+		if err != nil && p.auth.generation() != gen {
+			// CONNECT was challenged
+			continue
+		}
+		return response, err
+	}
+}
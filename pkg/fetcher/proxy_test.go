@@ -0,0 +1,132 @@
+package fetcher
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseAuthParams(t *testing.T) {
+	tests := []struct {
+		name, params string
+		want         map[string]string
+	}{
+		{"quoted", `realm="proxy", nonce="abc"`, map[string]string{"realm": "proxy", "nonce": "abc"}},
+		{"unquoted", `algorithm=SHA-256, stale=true`, map[string]string{"algorithm": "SHA-256", "stale": "true"}},
+		{"comma in quotes", `realm="a, b", qop="auth,auth-int"`, map[string]string{"realm": "a, b", "qop": "auth,auth-int"}},
+		{"escaped quote", `realm="say \"hi\"", nonce=n`, map[string]string{"realm": `say "hi"`, "nonce": "n"}},
+		{"key case and spaces", ` Realm = x ,NONCE="y"`, map[string]string{"realm": "x", "nonce": "y"}},
+		{"empty value", `opaque="", realm=r`, map[string]string{"opaque": "", "realm": "r"}},
+		{"unterminated quote", `realm="proxy`, map[string]string{"realm": "proxy"}},
+		{"no value", `realm`, map[string]string{}},
+		{"empty", ``, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAuthParams(tt.params)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseAuthParams(%q) = %q, want %q", tt.params, got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseAuthParams(%q)[%q] = %q, want %q", tt.params, k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+// digestResponse computes the Digest response of RFC 7616 3.4.1
+func digestResponse(h func() hash.Hash, user, pass, realm, nonce, method, uri, qop, nc, cnonce string) string {
+	hx := func(s string) string {
+		hh := h()
+		hh.Write([]byte(s))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ha1 := hx(user + ":" + realm + ":" + pass)
+	ha2 := hx(method + ":" + uri)
+	if qop == "" {
+		return hx(ha1 + ":" + nonce + ":" + ha2)
+	}
+	return hx(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+}
+
+func TestDigestResponse(t *testing.T) {
+	// The example of RFC 2617 3.5, checking digestResponse itself
+	got := digestResponse(md5.New, "Mufasa", "Circle Of Life", "testrealm@host.com", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "GET", "/dir/index.html", "auth", "00000001", "0a4f113b")
+	if want := "6629fae49393a05397450978507c4ef1"; got != want {
+		t.Fatalf("digestResponse = %s, want %s", got, want)
+	}
+}
+
+func TestProxyAuthHeader(t *testing.T) {
+	const user, pass, method, uri = "Mufasa", "Circle Of Life", "GET", "http://example.com/dir/index.html"
+	tests := []struct {
+		name      string
+		challenge string
+		hash      func() hash.Hash
+		algorithm string
+		qop       string
+	}{
+		{"MD5, qop auth", `Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`, md5.New, "MD5", "auth"},
+		{"MD5, no qop", `Digest realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093"`, md5.New, "MD5", ""},
+		{"SHA-256", `Digest realm="http-auth@example.org", qop="auth", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"`, sha256.New, "SHA-256", "auth"},
+		{"unknown algorithm, as MD5", `Digest realm="r", nonce="n", algorithm=MD4`, md5.New, "MD5", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProxyAuth(url.UserPassword(user, pass), defaultLogger())
+			h := make(http.Header)
+			h.Add("Proxy-Authenticate", `Basic realm="ignored"`)
+			h.Add("Proxy-Authenticate", tt.challenge)
+			if !p.challenged(h) {
+				t.Fatal("challenged() = false, want true")
+			}
+			challenge := parseAuthParams(strings.SplitN(tt.challenge, " ", 2)[1])
+
+			for n := 1; n <= 2; n++ {
+				v, ok := strings.CutPrefix(p.header(method, uri), "Digest ")
+				if !ok {
+					t.Fatalf("header() = %q, want Digest", v)
+				}
+				got := parseAuthParams(v)
+				for k, want := range map[string]string{"username": user, "realm": challenge["realm"], "nonce": challenge["nonce"], "uri": uri, "algorithm": tt.algorithm, "opaque": challenge["opaque"]} {
+					if got[k] != want {
+						t.Errorf("header() %s = %q, want %q", k, got[k], want)
+					}
+				}
+				if tt.qop == "" {
+					if _, ok := got["nc"]; ok {
+						t.Errorf("header() has nc %q without a qop", got["nc"])
+					}
+				} else if want := "0000000" + string(rune('0'+n)); got["nc"] != want {
+					t.Errorf("header() nc = %q, want %q", got["nc"], want)
+				}
+				want := digestResponse(tt.hash, user, pass, challenge["realm"], challenge["nonce"], method, uri, tt.qop, got["nc"], got["cnonce"])
+				if got["response"] != want {
+					t.Errorf("header() response = %q, want %q", got["response"], want)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyAuthBasic(t *testing.T) {
+	if p := newProxyAuth(nil, defaultLogger()); p != nil {
+		t.Errorf("newProxyAuth(nil) = %v, want nil", p)
+	}
+	p := newProxyAuth(url.UserPassword("Aladdin", "open sesame"), defaultLogger())
+	h := make(http.Header)
+	h.Set("Proxy-Authenticate", `Basic realm="proxy"`)
+	if p.challenged(h) {
+		t.Error("challenged() = true for a Basic challenge, want false")
+	}
+	if got, want := p.header("GET", "http://example.com/"), "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="; got != want {
+		t.Errorf("header() = %q, want %q", got, want)
+	}
+}
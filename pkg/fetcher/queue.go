@@ -0,0 +1,80 @@
+package fetcher
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// queueSource is an external queue that requests are consumed from, after
+// any input files, until interrupted. Each request it returns has an Ack,
+// called once the request has a result
+type queueSource interface {
+	// next returns the next request, blocking until there is one or ctx is done
+	next(ctx context.Context) (getRequest, error)
+	Close() error
+}
+
+// openSource returns the queueSource per the flags, or nil if none is set
+func (f *Fetcher) openSource() (queueSource, error) {
+	switch {
+	case f.RedisURL != "":
+		return newRedisQueue(f, f.RedisURL, f.RedisQueue, f.RedisGroup, f.RedisReclaim)
+	case f.SQSURL != "":
+		return newSQSQueue(f, f.SQSURL)
+	case f.KafkaIn != "":
+		return newKafkaQueue(f, f.KafkaBrokers, f.KafkaIn, f.KafkaGroup)
+	}
+	return nil, nil
+}
+
+// sourceSet returns true if a queueSource is set by the flags
+func (f *Fetcher) sourceSet() bool {
+	return f.RedisURL != "" || f.SQSURL != "" || f.KafkaIn != ""
+}
+
+// ack acknowledges the request to its queue, if it came from one
+func (r *getRequest) ack(ok bool) {
+	if r.Ack != nil {
+		r.Ack(ok)
+	}
+}
+
+// scanSource takes a queueSource, and a sender to send its requests to, and
+// does so until aborted or drained, returning false. Requests with invalid
+// URLs are logged, counted, and acknowledged as failed
+func (f *Fetcher) scanSource(q queueSource, s *sender) bool {
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.drained:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+
+	for {
+		req, err := q.next(ctx)
+		if ctx.Err() != nil {
+			f.Logger.Debug("scanner queue abort or drain seen")
+			return false
+		}
+		if err != nil {
+			f.Logger.Error("could not read from queue", "error", err)
+			// Don't spin while the queue is unavailable
+			time.Sleep(time.Second)
+			continue
+		}
+		if err := f.validURL(req.URL); err != nil {
+			// As for queued lines that don't parse, the queue decides what becomes of it
+			f.Logger.Warn("skipping invalid queued request", "url", req.URL, "error", err)
+			atomic.AddInt64(&f.inputStats.Invalid, 1)
+			req.ack(false)
+			continue
+		}
+		if !s.send(req) {
+			return false
+		}
+	}
+}
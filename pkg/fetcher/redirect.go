@@ -0,0 +1,54 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// redirectError is a redirect loop, a chain of redirects longer than
+// MaxRedirects, or a redirect to another scheme that isn't HTTP(S)
+type redirectError struct {
+	Loop   bool     // Whether the chain loops back on itself
+	Scheme bool     // Whether the chain leads to a scheme it may not
+	Chain  []string // The URLs redirected through, in order
+}
+
+// Error returns the kind of redirect problem, and its full path
+func (e *redirectError) Error() string {
+	kind := "REDIRECT-CHAIN"
+	if e.Loop {
+		kind = "REDIRECT-LOOP"
+	} else if e.Scheme {
+		kind = "REDIRECT-SCHEME"
+	}
+	return fmt.Sprintf("%s: %s", kind, strings.Join(e.Chain, " -> "))
+}
+
+// checkRedirect is an http.Client CheckRedirect function that follows redirects
+// unless they loop, there have been more than MaxRedirects of them, or they
+// lead from the original URL's scheme to another that isn't http or https, in
+// which case it returns a redirectError. Otherwise a remote server could have
+// local files (file://), or objects signed for with our credentials (s3://),
+// read as its response
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	chain := make([]string, 0, len(via)+1)
+	for _, v := range via {
+		chain = append(chain, v.URL.String())
+	}
+	chain = append(chain, req.URL.String())
+
+	if len(via) > 0 && req.URL.Scheme != via[0].URL.Scheme && req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return &redirectError{Scheme: true, Chain: chain}
+	}
+
+	for _, v := range via {
+		if v.URL.String() == req.URL.String() && v.Method == req.Method {
+			return &redirectError{Loop: true, Chain: chain}
+		}
+	}
+	if len(via) >= f.MaxRedirects {
+		return &redirectError{Chain: chain}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package fetcher
+
+import (
+	"github.com/redis/go-redis/v9"
+
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// redisQueue is a queueSource of input lines from a Redis list or stream.
+// Lists are consumed reliably, each item being moved to the consumer's own
+// processing list until acknowledged. Streams are consumed by a consumer
+// group, so multiple wgetpipes can share one, each entry's "url" field being
+// the line. Either way, what a consumer that died had taken is reclaimed by
+// the others once it has gone unacknowledged for the reclaim period
+type redisQueue struct {
+	f          *Fetcher // Whose InputFormat the items are in
+	client     *redis.Client
+	key        string
+	processing string // List of the items being processed, if a list
+	alive      string // Key that expires once this consumer has died, if a list
+	stream     bool
+	group      string // Consumer group, if a stream
+	consumer   string // Name of this consumer
+
+	reclaim   time.Duration    // How long before what a dead consumer took is reclaimed
+	reclaimAt time.Time        // When to next reclaim
+	claimed   []redis.XMessage // Stream entries reclaimed, to consume first
+	claimFrom string           // Where in the stream's pending entries to reclaim from next
+	done      chan bool        // Closed once closed, to stop keeping alive
+}
+
+// redisProcessing and redisAlive are the keys of a list consumer's
+// processing list and liveness, after the list's key
+const (
+	redisProcessing = ":processing:"
+	redisAlive      = ":alive:"
+)
+
+// newRedisQueue returns a redisQueue for f of the key at the redis:// URL,
+// using the consumer group if it's a stream
+func newRedisQueue(f *Fetcher, url, key, group string, reclaim time.Duration) (*redisQueue, error) {
+	if key == "" {
+		return nil, errors.New("-queue is required with -redis")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	consumer := fmt.Sprintf("%s-%d", host, os.Getpid())
+	q := &redisQueue{
+		f:          f,
+		client:     redis.NewClient(opts),
+		key:        key,
+		processing: key + redisProcessing + consumer,
+		alive:      key + redisAlive + consumer,
+		consumer:   consumer,
+		reclaim:    reclaim,
+		claimFrom:  "0",
+		done:       make(chan bool),
+	}
+
+	ctx := context.Background()
+	typ, err := q.client.Type(ctx, key).Result()
+	if err != nil {
+		q.client.Close()
+		return nil, err
+	}
+	if typ == "stream" {
+		q.stream = true
+		q.group = group
+		// Entries already in the stream are consumed too
+		if err := q.client.XGroupCreate(ctx, key, group, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			q.client.Close()
+			return nil, err
+		}
+		return q, nil
+	}
+
+	if err := q.client.Set(ctx, q.alive, 1, reclaim).Err(); err != nil {
+		q.client.Close()
+		return nil, err
+	}
+	go q.keepAlive()
+	return q, nil
+}
+
+// keepAlive says this list consumer is alive a few times every reclaim
+// period, however long the requests it has taken are taking, until closed
+func (q *redisQueue) keepAlive() {
+	t := time.NewTicker(q.reclaim / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-t.C:
+			if err := q.client.Set(context.Background(), q.alive, 1, q.reclaim).Err(); err != nil {
+				q.f.Logger.Error("could not keep Redis consumer alive", "error", err)
+			}
+		}
+	}
+}
+
+// next returns the next request from the list or stream, reclaiming what
+// dead consumers had taken first, when it's time to
+func (q *redisQueue) next(ctx context.Context) (getRequest, error) {
+	for {
+		if time.Now().After(q.reclaimAt) {
+			if err := q.reclaimDead(ctx); err != nil {
+				// Not fatal, e.g. to a Redis older than XAUTOCLAIM
+				q.f.Logger.Error("could not reclaim from dead Redis consumers", "error", err)
+			}
+		}
+
+		var (
+			line string
+			ack  func(ok bool)
+		)
+		if q.stream {
+			var msg redis.XMessage
+			if len(q.claimed) > 0 {
+				msg, q.claimed = q.claimed[0], q.claimed[1:]
+			} else {
+				streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+					Group:    q.group,
+					Consumer: q.consumer,
+					Streams:  []string{q.key, ">"},
+					Count:    1,
+					Block:    5 * time.Second,
+				}).Result()
+				if err == redis.Nil {
+					continue
+				} else if err != nil {
+					return getRequest{}, err
+				}
+				msg = streams[0].Messages[0]
+			}
+			line, _ = msg.Values["url"].(string) // Invalid if missing, so acknowledged by scanSource
+			ack = func(bool) {
+				if err := q.client.XAck(context.Background(), q.key, q.group, msg.ID).Err(); err != nil {
+					q.f.Logger.Error("could not acknowledge to Redis", "id", msg.ID, "error", err)
+				}
+			}
+		} else {
+			// Producers LPUSH, so the oldest is on the right
+			l, err := q.client.BLMove(ctx, q.key, q.processing, "RIGHT", "LEFT", 5*time.Second).Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				return getRequest{}, err
+			}
+			line = l
+			ack = func(bool) {
+				if err := q.client.LRem(context.Background(), q.processing, 1, l).Err(); err != nil {
+					q.f.Logger.Error("could not acknowledge to Redis", "item", l, "error", err)
+				}
+			}
+		}
+
+		req, err := q.f.parseLine(line)
+		if err != nil {
+			// It won't parse any better next time
+			q.f.Logger.Debug("scanner skipping queued line", "error", err)
+			ack(false)
+			continue
+		}
+		req.Ack = ack
+		return req, nil
+	}
+}
+
+// reclaimDead takes over the stream entries pending for longer than the
+// reclaim period, or puts the items of the processing lists of consumers no
+// longer alive back on the list
+func (q *redisQueue) reclaimDead(ctx context.Context) error {
+	q.reclaimAt = time.Now().Add(q.reclaim / 3)
+
+	if q.stream {
+		// A batch at a time, continuing through the pending entries next time
+		msgs, from, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   q.key,
+			Group:    q.group,
+			Consumer: q.consumer,
+			MinIdle:  q.reclaim,
+			Start:    q.claimFrom,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			q.f.Logger.Info("reclaimed Redis stream entries", "entries", len(msgs))
+		}
+		q.claimed = append(q.claimed, msgs...)
+		q.claimFrom = from
+		return nil
+	}
+
+	iter := q.client.Scan(ctx, 0, q.key+redisProcessing+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		processing := iter.Val()
+		consumer := strings.TrimPrefix(processing, q.key+redisProcessing)
+		if n, err := q.client.Exists(ctx, q.key+redisAlive+consumer).Result(); err != nil {
+			return err
+		} else if n > 0 {
+			continue
+		}
+		if n, err := q.requeue(ctx, processing); err != nil {
+			return err
+		} else if n > 0 {
+			q.f.Logger.Info("reclaimed Redis list items", "consumer", consumer, "items", n)
+		}
+	}
+	return iter.Err()
+}
+
+// requeue moves the items of the processing list back to the end of the list
+// they're consumed from, oldest last so it's consumed first, returning the
+// number moved
+func (q *redisQueue) requeue(ctx context.Context, processing string) (int, error) {
+	var n int
+	for {
+		err := q.client.LMove(ctx, processing, q.key, "LEFT", "RIGHT").Err()
+		if err == redis.Nil {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Close puts any items of a list not acknowledged back on it, rather than
+// leaving them to be reclaimed, and closes the connection
+func (q *redisQueue) Close() error {
+	close(q.done)
+	if !q.stream {
+		ctx := context.Background()
+		if _, err := q.requeue(ctx, q.processing); err != nil {
+			q.f.Logger.Error("could not requeue unacknowledged Redis list items", "error", err)
+		}
+		q.client.Del(ctx, q.alive)
+	}
+	return q.client.Close()
+}
@@ -0,0 +1,114 @@
+package fetcher
+
+import (
+	"sync"
+)
+
+// Results returns a channel of the results of the next Run, as they're
+// collated, which is closed once it ends. It must be called before each Run
+// to stream, and read promptly, as the getters are held back until each
+// result is taken
+func (f *Fetcher) Results() <-chan Result {
+	return f.streams().subscribe().records
+}
+
+// streams returns the broadcast of the results, starting a new one if there
+// is none, or the last Run's has closed
+func (f *Fetcher) streams() *broadcast {
+	if f.resultStreams == nil || f.resultStreams.ended() {
+		f.resultStreams = newBroadcast()
+	}
+	return f.resultStreams
+}
+
+// broadcast fans the result records out to subscribers, blocking until each
+// has taken them, so slow subscribers hold back collation
+type broadcast struct {
+	lock    sync.Mutex
+	sending sync.Mutex // Held while publishing, so records aren't closed mid-send
+	subs    map[*subscriber]bool
+	closed  bool
+}
+
+// subscriber is a subscription to a broadcast
+type subscriber struct {
+	records chan Result // Closed when the broadcast is
+	gone    chan bool   // Closed when unsubscribed
+}
+
+// newBroadcast returns a broadcast without subscribers
+func newBroadcast() *broadcast {
+	return &broadcast{subs: make(map[*subscriber]bool)}
+}
+
+// subscribe returns a new subscriber, whose records are closed at once if
+// the broadcast is
+func (b *broadcast) subscribe() *subscriber {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	sub := &subscriber{records: make(chan Result, 64), gone: make(chan bool)}
+	if b.closed {
+		close(sub.records)
+	} else {
+		b.subs[sub] = true
+	}
+	return sub
+}
+
+// unsubscribe removes the subscriber, so it's no longer waited on
+func (b *broadcast) unsubscribe(sub *subscriber) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.gone)
+	}
+}
+
+// ended returns whether the broadcast is closed
+func (b *broadcast) ended() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.closed
+}
+
+// publish sends the record to each subscriber, waiting for those whose
+// buffers are full, unless the broadcast is closed
+func (b *broadcast) publish(r Result) {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	subs := make([]*subscriber, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.lock.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.records <- r:
+		case <-sub.gone:
+		}
+	}
+}
+
+// close closes the subscribers' records, ending them after those already
+// sent, and drops them
+func (b *broadcast) close() {
+	b.sending.Lock()
+	defer b.sending.Unlock()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.records)
+	}
+	b.subs = make(map[*subscriber]bool)
+}
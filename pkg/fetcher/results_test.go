@@ -0,0 +1,24 @@
+package fetcher
+
+import (
+	"testing"
+)
+
+func TestResultsAcrossRuns(t *testing.T) {
+	f := New()
+	for run := 1; run <= 2; run++ {
+		records := f.Results()
+		f.resultStreams.publish(Result{URL: "http://example.com/", Code: 200})
+		f.resultStreams.close()
+		// Published after the run ended, so dropped
+		f.resultStreams.publish(Result{URL: "http://example.com/late", Code: 200})
+
+		var got []Result
+		for r := range records {
+			got = append(got, r)
+		}
+		if len(got) != 1 || got[0].URL != "http://example.com/" {
+			t.Errorf("run %d: got %v, want the one result published before closing", run, got)
+		}
+	}
+}
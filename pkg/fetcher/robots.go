@@ -0,0 +1,104 @@
+package fetcher
+
+import (
+	"github.com/temoto/robotstxt"
+
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// robotsAgent is the User-Agent we look for in robots.txt files
+const robotsAgent = "wgetpipe"
+
+// robotsHost is the robots.txt rules for a host, and the state
+// needed to honor its Crawl-delay
+type robotsHost struct {
+	once  sync.Once
+	group *robotstxt.Group
+
+	lock sync.Mutex
+	next time.Time // When the next request may be made, per the Crawl-delay
+}
+
+// robotsCache caches robots.txt rules per scheme and host
+type robotsCache struct {
+	f     *Fetcher // Whose Transport fetches the robots.txt
+	lock  sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+// newRobotsCache returns an initialized robotsCache for f
+func newRobotsCache(f *Fetcher) *robotsCache {
+	return &robotsCache{
+		f:     f,
+		hosts: make(map[string]*robotsHost),
+	}
+}
+
+// get returns the robotsHost for the URL's scheme and host, fetching its
+// robots.txt if this is the first time it's been seen
+func (r *robotsCache) get(u *url.URL) *robotsHost {
+	key := u.Scheme + "://" + u.Host
+
+	r.lock.Lock()
+	h, ok := r.hosts[key]
+	if !ok {
+		h = &robotsHost{}
+		r.hosts[key] = h
+	}
+	r.lock.Unlock()
+
+	h.once.Do(func() {
+		h.group = r.f.fetchRobots(key + "/robots.txt")
+	})
+	return h
+}
+
+// fetchRobots fetches and parses the robots.txt at the URL, returning
+// the group of rules that apply to us. Unfetchable robots.txt files
+// allow everything, unparsable ones nothing
+func (f *Fetcher) fetchRobots(u string) *robotstxt.Group {
+	c := &http.Client{Transport: f.Transport, Timeout: f.Timeout, CheckRedirect: f.checkRedirect}
+	response, err := c.Get(u)
+	if err != nil {
+		f.Logger.Warn("could not fetch robots.txt, allowing all", "url", u, "error", err)
+		return (&robotstxt.RobotsData{}).FindGroup(robotsAgent)
+	}
+	defer response.Body.Close()
+
+	data, err := robotstxt.FromResponse(response)
+	if err != nil {
+		f.Logger.Warn("could not parse robots.txt, disallowing all", "url", u, "error", err)
+		data, _ = robotstxt.FromStatusAndString(http.StatusInternalServerError, "")
+	}
+	return data.FindGroup(robotsAgent)
+}
+
+// allowed returns true if robots.txt allows the URL to be fetched
+func (r *robotsCache) allowed(u *url.URL) bool {
+	return r.get(u).group.Test(u.EscapedPath())
+}
+
+// wait blocks until the Crawl-delay of the URL's host, if any, allows another request
+func (r *robotsCache) wait(u *url.URL) {
+	h := r.get(u)
+	if h.group.CrawlDelay <= 0 {
+		return
+	}
+
+	h.lock.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(h.group.CrawlDelay)
+	h.lock.Unlock()
+
+	if d := time.Until(at); d > 0 {
+		r.f.Logger.Debug("Crawl-delay waiting", "delay", d, "url", u)
+		time.Sleep(d)
+	}
+}
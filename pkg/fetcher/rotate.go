@@ -0,0 +1,106 @@
+package fetcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rotatingFile is an io.Writer appending to a file, which is rotated aside
+// to a timestamped name once it grows past maxSize bytes or gets older than
+// maxAge (either may be 0 for never), keeping the newest keep rotated files
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	keep    int
+
+	lock   sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// newRotatingFile opens path for appending, to be rotated as above
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, keep int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		keep:    keep,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file, appending to whatever is already there
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = fi.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if p would take it past
+// maxSize, or it is past maxAge. A record is never split across files
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.size > 0 && ((r.maxSize > 0 && r.size+int64(len(p)) > r.maxSize) || (r.maxAge > 0 && time.Since(r.opened) >= r.maxAge)) {
+		if err := r.rotate(); err != nil {
+			// Keep logging to the old file rather than losing the record
+			fmt.Fprintf(os.Stderr, "Error rotating '%s': %s\n", r.path, err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the file aside, opens a new one, and removes the oldest
+// rotated files beyond keep
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	// Millisecond timestamps sort in order, and don't collide at any sane size
+	aside := fmt.Sprintf("%s.%s", r.path, time.Now().Format("20060102T150405.000"))
+	if err := os.Rename(r.path, aside); err != nil {
+		if oerr := r.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.keep > 0 {
+		old, err := filepath.Glob(r.path + ".[0-9]*T*")
+		if err != nil {
+			return err
+		}
+		sort.Strings(old)
+		for len(old) > r.keep {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package fetcher
+
+import (
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// s3Transport is an http.RoundTripper for s3://bucket/key URLs, registered
+// with the transport. GETs and HEADs are made as GetObject and HeadObject
+// calls, configured from the environment (credentials, AWS_REGION,
+// AWS_ENDPOINT_URL_S3, AWS_CA_BUNDLE, etc.) the first time, and dialling as
+// HTTP would, so they're timed and tallied like any other request. S3's error
+// responses (e.g. 403, 404) are answered as such
+type s3Transport struct {
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+	once    sync.Once
+	client  *s3.Client
+	err     error    // Configuring the client
+	regions sync.Map // Region by bucket, for those not in the configured one
+}
+
+// s3Client returns the S3 client, configuring it if need be
+func (t *s3Transport) s3Client(ctx context.Context) (*s3.Client, error) {
+	t.once.Do(func() {
+		t.client, t.err = newS3Client(ctx, t.dial, false)
+	})
+	return t.client, t.err
+}
+
+// newS3Client returns an S3 client configured from the environment, dialling
+// with dial, if not nil. With gs, it's for Google Cloud Storage's
+// S3-compatible XML API instead, with the HMAC key of GS_ACCESS_KEY_ID and
+// GS_SECRET_ACCESS_KEY, if set
+func newS3Client(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), gs bool) (*s3.Client, error) {
+	opts := []func(*config.LoadOptions) error{}
+	if dial != nil {
+		opts = append(opts, config.WithHTTPClient(awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+			tr.DialContext = dial
+		})))
+	}
+	if gs {
+		opts = append(opts, config.WithBaseEndpoint("https://storage.googleapis.com"))
+		if id, secret := os.Getenv("GS_ACCESS_KEY_ID"), os.Getenv("GS_SECRET_ACCESS_KEY"); id != "" {
+			opts = append(opts, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(id, secret, "")))
+		}
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+		if gs {
+			cfg.Region = "auto"
+		}
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// S3-compatible stores (e.g. MinIO) want bucket paths rather than
+		// bucket hostnames
+		o.UsePathStyle = gs || os.Getenv("AWS_ENDPOINT_URL_S3") != "" || os.Getenv("AWS_ENDPOINT_URL") != ""
+	}), nil
+}
+
+// inBucketRegion makes the call with the options for the bucket's region,
+// if it's known to be elsewhere, and if S3 says it is, again there
+func inBucketRegion(regions *sync.Map, bucket string, call func(optFns ...func(*s3.Options)) error) error {
+	optFns := func() []func(*s3.Options) {
+		if region, ok := regions.Load(bucket); ok {
+			return []func(*s3.Options){func(o *s3.Options) { o.Region = region.(string) }}
+		}
+		return nil
+	}
+	err := call(optFns()...)
+	if region := s3BucketRegion(err); region != "" {
+		regions.Store(bucket, region)
+		err = call(optFns()...)
+	}
+	return err
+}
+
+// RoundTrip makes the request as an S3 API call
+func (t *s3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return localResponse(req, "HTTP/1.1", http.StatusMethodNotAllowed, req.Method+" is not supported for s3:// URLs"), nil
+	}
+	if crossSchemeRedirect(req) {
+		// Not signing requests for whoever redirected us
+		return localResponse(req, "HTTP/1.1", http.StatusForbidden, "not following a redirect from "+req.Response.Request.URL.Scheme+" to s3://"), nil
+	}
+	bucket, key := req.URL.Host, strings.TrimPrefix(req.URL.Path, "/")
+	if bucket == "" || key == "" {
+		return localResponse(req, "HTTP/1.1", http.StatusBadRequest, "s3:// URLs are s3://bucket/key"), nil
+	}
+	client, err := t.s3Client(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	var response *http.Response
+	err = inBucketRegion(&t.regions, bucket, func(optFns ...func(*s3.Options)) (err error) {
+		response, err = t.call(req, client, bucket, key, optFns)
+		return err
+	})
+	if err != nil {
+		var rerr *awshttp.ResponseError
+		if errors.As(err, &rerr) {
+			// An S3 error response, whose message is in the error
+			response = localResponse(req, "HTTP/1.1", rerr.HTTPStatusCode(), err.Error())
+			if rerr.HTTPStatusCode() == http.StatusNotModified {
+				response.Body = http.NoBody
+				response.ContentLength = 0
+				response.Header.Del("Content-Type")
+			}
+			return response, nil
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// call makes the GetObject or HeadObject call for the request, with the
+// options, returning its output as a response
+func (t *s3Transport) call(req *http.Request, client *s3.Client, bucket, key string, optFns []func(*s3.Options)) (*http.Response, error) {
+	var ims *time.Time
+	if v, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+		ims = &v
+	}
+	inm := optional(req.Header.Get("If-None-Match"))
+	rng := optional(req.Header.Get("Range"))
+
+	response := localResponse(req, "HTTP/1.1", http.StatusOK, "")
+	var (
+		contentLength                                    *int64
+		contentType, contentEncoding, etag, cacheControl *string
+		lastModified                                     *time.Time
+	)
+	if req.Method == http.MethodHead {
+		out, err := client.HeadObject(req.Context(), &s3.HeadObjectInput{
+			Bucket: &bucket, Key: &key, IfModifiedSince: ims, IfNoneMatch: inm, Range: rng,
+		}, optFns...)
+		if err != nil {
+			return nil, err
+		}
+		contentLength, contentType, contentEncoding, etag, cacheControl, lastModified = out.ContentLength, out.ContentType, out.ContentEncoding, out.ETag, out.CacheControl, out.LastModified
+	} else {
+		out, err := client.GetObject(req.Context(), &s3.GetObjectInput{
+			Bucket: &bucket, Key: &key, IfModifiedSince: ims, IfNoneMatch: inm, Range: rng,
+		}, optFns...)
+		if err != nil {
+			return nil, err
+		}
+		contentLength, contentType, contentEncoding, etag, cacheControl, lastModified = out.ContentLength, out.ContentType, out.ContentEncoding, out.ETag, out.CacheControl, out.LastModified
+		response.Body = out.Body
+		if out.ContentRange != nil {
+			response.StatusCode = http.StatusPartialContent
+			response.Status = "206 " + http.StatusText(http.StatusPartialContent)
+			response.Header.Set("Content-Range", *out.ContentRange)
+		}
+	}
+
+	if contentLength != nil {
+		response.ContentLength = *contentLength
+		response.Header.Set("Content-Length", strconv.FormatInt(*contentLength, 10))
+	} else {
+		response.ContentLength = -1
+	}
+	for name, v := range map[string]*string{"Content-Type": contentType, "Content-Encoding": contentEncoding, "ETag": etag, "Cache-Control": cacheControl} {
+		if v != nil && *v != "" {
+			response.Header.Set(name, *v)
+		}
+	}
+	if lastModified != nil {
+		response.Header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if response.Body == nil {
+		response.Body = http.NoBody
+	}
+	return response, nil
+}
+
+// s3BucketRegion returns the region S3 said the bucket is in, when it was
+// asked in another, or ""
+func s3BucketRegion(err error) string {
+	var rerr *awshttp.ResponseError
+	if !errors.As(err, &rerr) || rerr.Response == nil {
+		return ""
+	}
+	switch rerr.HTTPStatusCode() {
+	case http.StatusMovedPermanently, http.StatusBadRequest:
+		return rerr.Response.Header.Get("X-Amz-Bucket-Region")
+	}
+	return ""
+}
+
+// optional returns a pointer to the string, or nil if it's empty
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,341 @@
+package fetcher
+
+import (
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	s3MinPartSize = 5 << 20 // The smallest part S3 takes, but for the last
+	s3MaxParts    = 10000   // The most parts an S3 multipart upload may have
+)
+
+// s3Upload takes a context and getRequest, and uploads the getRequest's File
+// to its s3://bucket/key URL: in one PutObject if it fits in a part, else as a
+// multipart upload of ChunkSize parts (at least 5MiB), resuming any
+// checkpointed upload of it. It returns a response standing for S3's, and the
+// number of bytes uploaded by this call
+func (f *Fetcher) s3Upload(ctx context.Context, req *getRequest) (*http.Response, int64, error) {
+	method := f.methodFor(req)
+	hreq, err := http.NewRequestWithContext(ctx, method, req.URL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if method != http.MethodPut {
+		return localResponse(hreq, "HTTP/1.1", http.StatusMethodNotAllowed, method+" is not supported for uploads to s3:// URLs"), 0, nil
+	}
+	bucket, key := hreq.URL.Host, strings.TrimPrefix(hreq.URL.Path, "/")
+	if bucket == "" || key == "" {
+		return localResponse(hreq, "HTTP/1.1", http.StatusBadRequest, "s3:// URLs are s3://bucket/key"), 0, nil
+	}
+
+	file, err := os.Open(req.File)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := fi.Size()
+
+	client, err := f.s3.s3Client(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	u := &s3Uploader{
+		t: f.s3, client: client, bucket: bucket, key: key,
+		file: file, contentType: f.uploadContentType(req),
+	}
+
+	partSize := f.s3PartSize(size)
+
+	var (
+		etag     string
+		uploaded int64
+	)
+	if size <= partSize {
+		etag, err = u.put(ctx, size)
+		if err == nil {
+			uploaded = size
+		}
+	} else {
+		etag, uploaded, err = f.s3Multipart(ctx, u, req.URL+"\t"+req.File, size, partSize)
+	}
+	if err != nil {
+		var rerr *awshttp.ResponseError
+		if errors.As(err, &rerr) {
+			// An S3 error response, whose message is in the error
+			return localResponse(hreq, "HTTP/1.1", rerr.HTTPStatusCode(), err.Error()), uploaded, nil
+		}
+		return nil, uploaded, err
+	}
+
+	response := localResponse(hreq, "HTTP/1.1", http.StatusOK, "")
+	if etag != "" {
+		response.Header.Set("ETag", etag)
+	}
+	return response, uploaded, nil
+}
+
+// s3PartSize returns the size of the parts to upload a file of size bytes in:
+// ChunkSize (at least 5MiB), unless that would be too many parts
+func (f *Fetcher) s3PartSize(size int64) int64 {
+	partSize := max(f.ChunkSize, s3MinPartSize)
+	if parts := (size + partSize - 1) / partSize; parts > s3MaxParts {
+		partSize = (size + s3MaxParts - 1) / s3MaxParts
+	}
+	return partSize
+}
+
+// multipartETag returns the ETag S3 gives the object of a multipart upload
+// of the file in partSize parts, unquoted: the MD5 of the parts' MD5s, and
+// the number of parts, e.g. "9b2cf535f27731c974343645a3985328-3"
+func multipartETag(file string, partSize int64) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	sums := md5.New()
+	var n int
+	for {
+		part := md5.New()
+		copied, err := io.CopyN(part, f, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if copied == 0 && n > 0 {
+			break
+		}
+		sums.Write(part.Sum(nil))
+		n++
+		if copied < partSize {
+			break
+		}
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), n), nil
+}
+
+// s3Multipart uploads the file with the uploader as a multipart upload of
+// partSize parts, resuming the upload checkpointed for the key if there is
+// one, and the parts of it that S3 already has. It returns the ETag of the
+// object, and the number of bytes uploaded by this call. An upload that fails
+// is left to be resumed if it's checkpointed, else aborted
+func (f *Fetcher) s3Multipart(ctx context.Context, u *s3Uploader, key string, size, partSize int64) (string, int64, error) {
+	var have map[int32]types.Part
+	id := f.checkpoints.get(key)
+	if id != "" {
+		var err error
+		if have, err = u.listParts(ctx, id); err != nil {
+			f.Logger.Debug("not resuming upload", "file", u.file.Name(), "upload", id, "error", err)
+			id = ""
+		} else {
+			f.Logger.Debug("resuming upload", "file", u.file.Name(), "upload", id, "parts", len(have))
+		}
+	}
+	if id == "" {
+		var err error
+		if id, err = u.create(ctx); err != nil {
+			return "", 0, err
+		}
+		f.checkpoints.set(key, id)
+	}
+
+	var (
+		parts    []types.CompletedPart
+		uploaded int64
+	)
+	etag, err := func() (string, error) {
+		for n, offset := int32(1), int64(0); offset < size; n, offset = n+1, offset+partSize {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			part := io.NewSectionReader(u.file, offset, min(partSize, size-offset))
+			h := md5.New()
+			if _, err := io.Copy(h, part); err != nil {
+				return "", err
+			}
+			sum := h.Sum(nil)
+
+			etag := `"` + hex.EncodeToString(sum) + `"`
+			if p, ok := have[n]; ok && p.Size != nil && *p.Size == part.Size() && p.ETag != nil && *p.ETag == etag {
+				f.Logger.Debug("part already uploaded", "file", u.file.Name(), "part", n)
+			} else {
+				var err error
+				if etag, err = u.uploadPart(ctx, id, n, part, sum); err != nil {
+					return "", err
+				}
+				uploaded += part.Size()
+			}
+			parts = append(parts, types.CompletedPart{ETag: &etag, PartNumber: &n})
+		}
+		return u.complete(ctx, id, parts)
+	}()
+	if err != nil {
+		if f.checkpoints == nil {
+			// Nothing will resume it, so S3 needn't keep its parts
+			if aerr := u.abort(context.WithoutCancel(ctx), id); aerr != nil {
+				f.Logger.Warn("could not abort upload", "url", "s3://"+u.bucket+"/"+u.key, "upload", id, "error", aerr)
+			}
+		}
+		return "", uploaded, err
+	}
+	f.checkpoints.set(key, "")
+	return etag, uploaded, nil
+}
+
+// s3Uploader makes the S3 calls to upload a file as an object
+type s3Uploader struct {
+	t           *s3Transport // For the regions of buckets
+	client      *s3.Client
+	bucket, key string
+	file        *os.File
+	contentType string
+}
+
+// call makes the call with the options for the bucket's region
+func (u *s3Uploader) call(call func(optFns ...func(*s3.Options)) error) error {
+	return inBucketRegion(&u.t.regions, u.bucket, call)
+}
+
+// put uploads the first size bytes of the file as the object, returning its
+// ETag
+func (u *s3Uploader) put(ctx context.Context, size int64) (string, error) {
+	body := io.NewSectionReader(u.file, 0, size)
+	h := md5.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	sum := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	var out *s3.PutObjectOutput
+	err := u.call(func(optFns ...func(*s3.Options)) (err error) {
+		body.Seek(0, io.SeekStart)
+		out, err = u.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: &u.bucket, Key: &u.key, Body: body, ContentLength: &size,
+			ContentMD5: &sum, ContentType: &u.contentType,
+		}, optFns...)
+		return err
+	})
+	if err != nil || out.ETag == nil {
+		return "", err
+	}
+	return *out.ETag, nil
+}
+
+// create starts a multipart upload of the object, returning its ID
+func (u *s3Uploader) create(ctx context.Context) (string, error) {
+	var out *s3.CreateMultipartUploadOutput
+	err := u.call(func(optFns ...func(*s3.Options)) (err error) {
+		out, err = u.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket: &u.bucket, Key: &u.key, ContentType: &u.contentType,
+		}, optFns...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.UploadId == nil {
+		return "", errors.New("S3 gave no upload ID")
+	}
+	return *out.UploadId, nil
+}
+
+// listParts returns the parts S3 has of the upload, by number
+func (u *s3Uploader) listParts(ctx context.Context, id string) (map[int32]types.Part, error) {
+	parts := make(map[int32]types.Part)
+	var marker *string
+	for {
+		var out *s3.ListPartsOutput
+		err := u.call(func(optFns ...func(*s3.Options)) (err error) {
+			out, err = u.client.ListParts(ctx, &s3.ListPartsInput{
+				Bucket: &u.bucket, Key: &u.key, UploadId: &id, PartNumberMarker: marker,
+			}, optFns...)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range out.Parts {
+			if p.PartNumber != nil {
+				parts[*p.PartNumber] = p
+			}
+		}
+		if out.IsTruncated == nil || !*out.IsTruncated || out.NextPartNumberMarker == nil {
+			return parts, nil
+		}
+		marker = out.NextPartNumberMarker
+	}
+}
+
+// uploadPart uploads the part, whose MD5 is sum, as the upload's part n,
+// returning its ETag
+func (u *s3Uploader) uploadPart(ctx context.Context, id string, n int32, part *io.SectionReader, sum []byte) (string, error) {
+	size := part.Size()
+	contentMD5 := base64.StdEncoding.EncodeToString(sum)
+	var out *s3.UploadPartOutput
+	err := u.call(func(optFns ...func(*s3.Options)) (err error) {
+		part.Seek(0, io.SeekStart)
+		out, err = u.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket: &u.bucket, Key: &u.key, UploadId: &id, PartNumber: &n,
+			Body: part, ContentLength: &size, ContentMD5: &contentMD5,
+		}, optFns...)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ETag == nil {
+		return "", errors.New("S3 gave no ETag for part")
+	}
+	return *out.ETag, nil
+}
+
+// complete completes the upload of the parts, returning the object's ETag
+func (u *s3Uploader) complete(ctx context.Context, id string, parts []types.CompletedPart) (string, error) {
+	var out *s3.CompleteMultipartUploadOutput
+	err := u.call(func(optFns ...func(*s3.Options)) (err error) {
+		out, err = u.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket: &u.bucket, Key: &u.key, UploadId: &id,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		}, optFns...)
+		return err
+	})
+	if err != nil || out.ETag == nil {
+		return "", err
+	}
+	return *out.ETag, nil
+}
+
+// abort aborts the upload, so S3 drops its parts
+func (u *s3Uploader) abort(ctx context.Context, id string) error {
+	return u.call(func(optFns ...func(*s3.Options)) error {
+		_, err := u.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket: &u.bucket, Key: &u.key, UploadId: &id,
+		}, optFns...)
+		return err
+	})
+}
+
+// isS3 returns true if the URL is an s3:// one
+func isS3(u string) bool {
+	pu, err := url.Parse(u)
+	return err == nil && pu.Scheme == "s3"
+}
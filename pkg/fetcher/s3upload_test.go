@@ -0,0 +1,49 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultipartETag(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 25) // 250 bytes
+	file := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// What S3 gives: the MD5 of the parts' MD5s, and the number of parts
+	etag := func(parts ...[]byte) string {
+		sums := md5.New()
+		for _, p := range parts {
+			sum := md5.Sum(p)
+			sums.Write(sum[:])
+		}
+		return hex.EncodeToString(sums.Sum(nil)) + "-" + string(rune('0'+len(parts)))
+	}
+
+	tests := []struct {
+		name     string
+		partSize int64
+		want     string
+	}{
+		{"uneven parts", 100, etag(data[:100], data[100:200], data[200:])},
+		{"even parts", 125, etag(data[:125], data[125:])},
+		{"one part", 250, etag(data)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := multipartETag(file, tt.partSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("multipartETag(%d) = %s, want %s", tt.partSize, got, tt.want)
+			}
+		})
+	}
+}
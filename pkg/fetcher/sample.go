@@ -0,0 +1,76 @@
+package fetcher
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// sampler randomly selects a subset of the input: either each request
+// with a given percent chance, or a fixed-size sample of all of them
+type sampler struct {
+	rand      *rand.Rand
+	percent   float64      // Chance of each request being kept, if non-zero
+	size      int          // Number of requests to keep, if non-zero
+	reservoir []getRequest // Requests kept so far, if size is set
+	Seen      int64        // Requests offered, atomically
+	Kept      int64        // Requests kept, atomically
+}
+
+// newSampler takes a -sample spec, either a percentage (e.g. "5%") or a
+// count (e.g. "1000"), and a random seed, and returns a sampler for it
+func newSampler(spec string, seed int64) (*sampler, error) {
+	s := &sampler{rand: rand.New(rand.NewSource(seed))}
+	if p, ok := strings.CutSuffix(spec, "%"); ok {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f <= 0 || f > 100 {
+			return nil, fmt.Errorf("invalid percentage '%s'", spec)
+		}
+		s.percent = f
+		return s, nil
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid sample '%s', must be a percentage or a positive count", spec)
+	}
+	s.size = n
+	return s, nil
+}
+
+// keep offers the request to the sampler, returning true if it should be
+// sent now. Requests kept for a fixed-size sample are held until flush.
+// Requests left out of the sample are acknowledged, as they won't be fetched
+func (s *sampler) keep(req getRequest) bool {
+	seen := atomic.AddInt64(&s.Seen, 1)
+	if s.percent > 0 {
+		if s.rand.Float64()*100 < s.percent {
+			atomic.AddInt64(&s.Kept, 1)
+			return true
+		}
+		req.ack(true)
+		return false
+	}
+
+	// Reservoir sampling, so every request has an equal chance regardless
+	// of how many there turn out to be
+	if len(s.reservoir) < s.size {
+		s.reservoir = append(s.reservoir, req)
+	} else if j := s.rand.Int63n(seen); j < int64(s.size) {
+		s.reservoir[j].ack(true)
+		s.reservoir[j] = req
+	} else {
+		req.ack(true)
+	}
+	return false
+}
+
+// flush returns the requests held for a fixed-size sample, once the
+// input is exhausted
+func (s *sampler) flush() []getRequest {
+	r := s.reservoir
+	s.reservoir = nil
+	atomic.AddInt64(&s.Kept, int64(len(r)))
+	return r
+}
@@ -0,0 +1,408 @@
+package fetcher
+
+import (
+	"github.com/cognusion/go-humanity"
+
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// saver saves response bodies somewhere, for -save
+type saver interface {
+	// save saves the contents as the URL's, returning whether they were
+	// written, or were already there
+	save(u string, contents []byte) (bool, error)
+	// copy saves what was saved as the from URL's as the to URL's too,
+	// returning whether it was written, for -etag-dedupe
+	copy(from, to string) (bool, error)
+}
+
+// localSaver is a saver into the current directory, as SaveFile saves
+type localSaver struct {
+	sync bool         // Whether to fsync the files, and their directories
+	log  *slog.Logger // Where diagnostics are logged
+}
+
+// save saves the contents as SaveFile does
+func (l localSaver) save(u string, contents []byte) (bool, error) {
+	return saveFile(u, contents, l.sync, l.log)
+}
+
+// copy copies the from URL's file with copySaved
+func (l localSaver) copy(from, to string) (bool, error) {
+	return copySaved(from, to, l.sync, l.log)
+}
+
+// SaveFile takes a URL and a pointer to a []byte containing the to-be-saved bytes,
+// and saves the full url as the path (sans scheme).
+// e.g. 'https://somewhere.com/1/2/3/4/5.html' will be saved as './somewhere.com/1/2/3/4/5.html',
+// and 'https://somewhere.com/1/' as './somewhere.com/1/index.html'.
+// If the file already exists with identical contents, it is not rewritten (nor its mtime
+// changed), and false is returned. The file is written to a temporary file first,
+// and renamed over it once complete, so a failed save never leaves it truncated.
+func SaveFile(saveAs string, contents *[]byte) (bool, error) {
+	return saveFile(saveAs, *contents, false, defaultLogger())
+}
+
+// saveFile saves the contents as SaveFile does, fsyncing the file and its
+// directory if sync is set
+func saveFile(saveAs string, contents []byte, sync bool, log *slog.Logger) (bool, error) {
+	url, err := url.Parse(saveAs)
+	if err != nil {
+		return false, err
+	}
+
+	file := savePath(url)
+	if !filepath.IsLocal(file) {
+		// savePath shouldn't allow it, but just in case
+		return false, fmt.Errorf("'%s' would be saved outside of the current directory", saveAs)
+	}
+	if same, err := sameContents(file, contents); err != nil {
+		return false, err
+	} else if same {
+		log.Debug("unchanged file", "path", file)
+		return false, nil
+	}
+
+	log.Debug("saved file", "dir", filepath.Dir(file), "path", file)
+	err = os.MkdirAll(filepath.Dir(file), os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+
+	err = writeFile(file, contents, sync)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFile writes the contents to the file atomically: into a temporary file
+// in its directory, renamed over it once complete. If sync is set, the
+// temporary file is fsynced before the rename, and the directory after it
+func writeFile(file string, contents []byte, sync bool) error {
+	dir := filepath.Dir(file)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil && sync {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if sync {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// syncDir fsyncs the directory, so entries renamed into it are durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// sameContents returns true if the named file exists, and its hash
+// matches that of the contents
+func sameContents(file string, contents []byte) (bool, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if fi, err := f.Stat(); err != nil {
+		return false, err
+	} else if !fi.Mode().IsRegular() || fi.Size() != int64(len(contents)) {
+		// Different sizes can't be the same
+		return false, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	ch := sha256.Sum256(contents)
+	return bytes.Equal(h.Sum(nil), ch[:]), nil
+}
+
+// savePath returns the local path that the URL is saved to, which is always
+// within its hostDir, however hostile the URL. Directories (e.g. '/' or
+// '/foo/') are saved as their index.html
+func savePath(u *url.URL) string {
+	p := safePath(u)
+	if strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	return hostDir(u) + p
+}
+
+// saveAs returns the URL that the response from the URL is to be saved as
+// (i.e. named by savePath): itself, unless -content-disposition is set and the
+// response names a file, in which case that file in the URL's folder, or
+// -save-query is set and the URL has a query, which is then kept in the name
+func (f *Fetcher) saveAs(u string, header http.Header) string {
+	if !f.SaveDisposition && (f.SaveQuery == "" || !strings.Contains(u, "?")) {
+		return u
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	as := u
+	if name := dispositionName(header); f.SaveDisposition && name != "" {
+		dir := pu.EscapedPath()
+		if !strings.HasSuffix(dir, "/") {
+			dir = path.Dir(dir)
+		}
+		setEscapedPath(pu, strings.TrimSuffix(dir, "/")+"/"+url.PathEscape(name))
+		as = pu.String()
+		f.Logger.Debug("saving as Content-Disposition filename", "url", u, "filename", name)
+	}
+	if f.SaveQuery != "" && pu.RawQuery != "" {
+		p := pu.EscapedPath()
+		if p == "" || strings.HasSuffix(p, "/") {
+			p = strings.TrimSuffix(p, "/") + "/index.html"
+		}
+		setEscapedPath(pu, p+"@"+url.PathEscape(queryName(pu.RawQuery, f.SaveQuery == "hash")))
+		pu.RawQuery = ""
+		as = pu.String()
+	}
+	return as
+}
+
+// setEscapedPath sets the URL's path to the escaped one, keeping any escaped
+// separators in it escaped
+func setEscapedPath(u *url.URL, escaped string) {
+	u.RawPath = escaped
+	u.Path, _ = url.PathUnescape(escaped)
+}
+
+// dispositionName returns the filename of the Content-Disposition header, if
+// any. Only a name, never a path, is taken from the server
+func dispositionName(header http.Header) string {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	name := path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// queryName returns the (still escaped) query as it's kept in a file name, or
+// its hash if asked, or if it's too long to be kept in one
+func queryName(query string, hash bool) string {
+	if hash || len(query) > 200 {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(query)))[:16]
+	}
+	return strings.NewReplacer("/", "%2F", "\\", "%5C").Replace(query)
+}
+
+// safePath returns the URL's path with its dot segments resolved, never above
+// the root, and with any separators (/ or \) or NULs that were encoded in a
+// segment (e.g. %2F) kept encoded, so that segment is still one file name. A
+// trailing / is kept
+func safePath(u *url.URL) string {
+	var (
+		segments []string
+		dir      bool // Whether the last segment is a directory
+	)
+	for _, s := range strings.Split(u.EscapedPath(), "/") {
+		if us, err := url.PathUnescape(s); err == nil {
+			s = us
+		}
+		dir = true
+		switch s {
+		case "", ".":
+			continue
+		case "..":
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+			continue
+		}
+		s = strings.NewReplacer("/", "%2F", "\\", "%5C", "\x00", "%00").Replace(s)
+		segments = append(segments, s)
+		dir = false
+	}
+
+	p := "/" + strings.Join(segments, "/")
+	if dir && len(segments) > 0 {
+		p += "/"
+	}
+	return p
+}
+
+// hostDir returns the directory that the URL's host is saved into: its
+// hostname, with the colons of any IPv6 literal replaced by '-', followed by
+// '_' and the port if it isn't the default for the scheme. URLs without a
+// host (e.g. file:///) are saved into a directory named for the scheme, and
+// those without either (e.g. a bare path) into '_'.
+// e.g. 'https://[::1]:8443/' is saved into '--1_8443'
+func hostDir(u *url.URL) string {
+	if u.Host == "" {
+		if u.Scheme == "" {
+			return "_"
+		}
+		return u.Scheme
+	}
+	dir := strings.NewReplacer(":", "-", "/", "_", "\\", "_").Replace(u.Hostname())
+	if dir == "" || dir == "." || dir == ".." {
+		// Not a real host, but not to be confused with a directory either
+		dir = "_" + dir
+	}
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		dir += "_" + port
+	}
+	return dir
+}
+
+// recordSaved records that the URL was saved, as the saveAs URL, and whether it
+// is HTML, for -convert-links
+func (f *Fetcher) recordSaved(saved, saveAs string, html bool) {
+	u, err := url.Parse(saved)
+	if err != nil {
+		return
+	}
+	f.savedLock.Lock()
+	defer f.savedLock.Unlock()
+	f.savedURLs[u.String()] = html
+	if saveAs != saved {
+		f.savedAs[u.String()] = saveAs
+	}
+}
+
+// savedFile returns the path of the file the URL was saved to. savedLock must
+// be held
+func (f *Fetcher) savedFile(u *url.URL) string {
+	if as, ok := f.savedAs[u.String()]; ok {
+		if au, err := url.Parse(as); err == nil {
+			return savePath(au)
+		}
+	}
+	return savePath(u)
+}
+
+// convertLinks rewrites the links in every saved HTML file that point to
+// other saved files, into relative paths to those files
+func (f *Fetcher) convertLinks() {
+	f.savedLock.Lock()
+	defer f.savedLock.Unlock()
+
+	for saved, html := range f.savedURLs {
+		if !html {
+			continue
+		}
+		if err := f.convertFileLinks(saved); err != nil {
+			f.Logger.Error("could not convert links", "path", saved, "error", err)
+		}
+	}
+}
+
+// convertFileLinks rewrites the links in the saved HTML file for the URL that
+// point to other saved files, into relative paths to those files. savedLock
+// must be held
+func (f *Fetcher) convertFileLinks(saved string) error {
+	base, err := url.Parse(saved)
+	if err != nil {
+		return err
+	}
+	file := f.savedFile(base)
+	dir := filepath.Dir(file)
+
+	body, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	b, changed, err := rewriteLinks(body, func(link string) (string, bool) {
+		u, frag, err := resolveLink(base, link)
+		if err != nil {
+			return "", false
+		}
+		if _, ok := f.savedURLs[u.String()]; !ok {
+			return "", false
+		}
+		rel, err := filepath.Rel(dir, f.savedFile(u))
+		if err != nil {
+			return "", false
+		}
+		rel = filepath.ToSlash(rel)
+		if frag != "" {
+			rel += "#" + frag
+		}
+		return rel, rel != link
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	f.Logger.Debug("converted links", "path", file)
+	return writeFile(file, b, f.Sync)
+}
+
+// budgetedSave saves size bytes with the save func, unless they would exceed
+// the -max-disk budget, in which case nothing more is saved for the rest of
+// the run, and the urlCode is marked NotSaved. Otherwise its Unchanged is set,
+// and true returned, if the save succeeded
+func (f *Fetcher) budgetedSave(uc *urlCode, size int64, save func() (bool, error)) bool {
+	if f.MaxDisk > 0 {
+		if used := atomic.AddInt64(&f.diskUsed, size); used > f.MaxDisk || f.diskFull.Load() {
+			atomic.AddInt64(&f.diskUsed, -size)
+			if !f.diskFull.Swap(true) {
+				f.Logger.Warn("disk budget reached, no longer saving", "max_disk", humanity.ByteFormat(f.MaxDisk), "url", uc.URL)
+			}
+			uc.NotSaved = "disk budget"
+			return false
+		}
+	}
+
+	written, err := save()
+	if !written && f.MaxDisk > 0 {
+		// Nothing was written, so nothing was spent
+		atomic.AddInt64(&f.diskUsed, -size)
+	}
+	if err != nil {
+		f.Logger.Error("could not save file", "url", uc.URL, "error", err)
+		return false
+	}
+	uc.Unchanged = !written
+	return true
+}
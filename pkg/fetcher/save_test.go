@@ -0,0 +1,172 @@
+package fetcher
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// within fails the test unless the path stays under the directory it's
+// relative to
+func within(t *testing.T, u, p string) {
+	t.Helper()
+	if !filepath.IsLocal(p) {
+		t.Errorf("%q is saved as %q, outside of the save directory", u, p)
+	}
+}
+
+func TestSavePath(t *testing.T) {
+	tests := []struct {
+		name, url, want string
+	}{
+		{"plain", "http://example.com/a/b.html", "example.com/a/b.html"},
+		{"dot segments", "http://example.com/a/../../../etc/passwd", "example.com/etc/passwd"},
+		{"dot segments only", "http://example.com/../..", "example.com/index.html"},
+		{"current segments", "http://example.com/./a/./b", "example.com/a/b"},
+		{"encoded dot segments", "http://example.com/%2e%2e/%2E%2E/etc/passwd", "example.com/etc/passwd"},
+		{"encoded slash", "http://example.com/..%2F..%2Fetc%2Fpasswd", "example.com/..%2F..%2Fetc%2Fpasswd"},
+		{"encoded backslash", "http://example.com/..%5C..%5Cetc%5Cpasswd", "example.com/..%5C..%5Cetc%5Cpasswd"},
+		{"encoded slash, lowercase", "http://example.com/a%2fb", "example.com/a%2Fb"},
+		{"NUL", "http://example.com/a%00.html", "example.com/a%00.html"},
+		{"absolute path", "/etc/passwd", "_/etc/passwd"},
+		{"absolute path, dot segments", "/../../etc/passwd", "_/etc/passwd"},
+		{"double slashes", "http://example.com//etc//passwd", "example.com/etc/passwd"},
+		{"no host", "http:///etc/passwd", "http/etc/passwd"},
+		{"dot dot host", "http://..:8080/x", "_.._8080/x"},
+		{"IPv6", "http://[::1]/a", "--1/a"},
+		{"IPv6 port", "https://[::1]:8443/a", "--1_8443/a"},
+		{"IPv6 default port", "https://[2001:db8::1]:443/", "2001-db8--1/index.html"},
+		{"port", "http://example.com:8080/a", "example.com_8080/a"},
+		{"default port", "http://example.com:80/a", "example.com/a"},
+		{"file", "file:///etc/passwd", "file/etc/passwd"},
+		{"file dot segments", "file:///../../etc/passwd", "file/etc/passwd"},
+		{"file host", "file://../../etc/passwd", "_../etc/passwd"},
+		{"root", "http://example.com", "example.com/index.html"},
+		{"root slash", "http://example.com/", "example.com/index.html"},
+		{"directory", "http://example.com/a/", "example.com/a/index.html"},
+		{"dot segment to directory", "http://example.com/a/b/..", "example.com/a/index.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := savePath(u)
+			within(t, tt.url, got)
+			if got != tt.want {
+				t.Errorf("savePath(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSavePathCollisions(t *testing.T) {
+	// Each pair is saved to different files
+	tests := []struct {
+		name, a, b string
+	}{
+		{"encoded slash", "http://example.com/a/b", "http://example.com/a%2Fb"},
+		{"encoded backslash", "http://example.com/a/b", "http://example.com/a%5Cb"},
+		{"encoded dot segments", "http://example.com/a/b", "http://example.com/a%2F..%2Fb"},
+		{"index", "http://example.com/a/", "http://example.com/a/index.htm"},
+		{"port", "http://example.com/a", "http://example.com:8080/a"},
+		{"scheme port", "http://example.com:443/a", "https://example.com:443/a"},
+		{"IPv6 hosts", "http://[::1]/a", "http://[::1:0]/a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ua, err := url.Parse(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ub, err := url.Parse(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pa, pb := savePath(ua), savePath(ub); pa == pb {
+				t.Errorf("%q and %q are both saved as %q", tt.a, tt.b, pa)
+			}
+		})
+	}
+}
+
+func TestSaveAs(t *testing.T) {
+	tests := []struct {
+		name, url, disposition, query, want string
+	}{
+		{"unchanged", "http://example.com/a/b", "", "", "example.com/a/b"},
+		{"disposition", "http://example.com/a/b", `attachment; filename="c.zip"`, "", "example.com/a/c.zip"},
+		{"disposition in directory", "http://example.com/a/", `attachment; filename="c.zip"`, "", "example.com/a/c.zip"},
+		{"disposition dot segments", "http://example.com/a/b", `attachment; filename="../../../etc/passwd"`, "", "example.com/a/passwd"},
+		{"disposition backslashes", "http://example.com/a/b", `attachment; filename="..\\..\\etc\\passwd"`, "", "example.com/a/passwd"},
+		{"disposition dot dot", "http://example.com/a/b", `attachment; filename=".."`, "", "example.com/a/b"},
+		{"disposition absolute", "http://example.com/a/b", `attachment; filename="/etc/passwd"`, "", "example.com/a/passwd"},
+		{"query", "http://example.com/a?id=1", "", "append", "example.com/a@id=1"},
+		{"query index", "http://example.com/?id=1", "", "append", "example.com/index.html@id=1"},
+		{"query slashes", "http://example.com/a?p=../../../etc/passwd", "", "append", "example.com/a@p=..%2F..%2F..%2Fetc%2Fpasswd"},
+		{"query hash", "http://example.com/a?p=../../x", "", "hash", "example.com/a@"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fetcher{Config: Config{SaveDisposition: tt.disposition != "", SaveQuery: tt.query, Logger: defaultLogger()}}
+			header := http.Header{}
+			if tt.disposition != "" {
+				header.Set("Content-Disposition", tt.disposition)
+			}
+			u, err := url.Parse(f.saveAs(tt.url, header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := savePath(u)
+			within(t, tt.url, got)
+			if got != tt.want && !(tt.query == "hash" && strings.HasPrefix(got, tt.want)) {
+				t.Errorf("saveAs(%q) is saved as %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "save")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for _, u := range []string{
+		"http://example.com/../../escaped",
+		"http://example.com/..%2F..%2Fescaped",
+		"http://example.com/..%5C..%5Cescaped",
+		"/../escaped",
+		"file:///../../escaped",
+		"file://../../escaped",
+		"http://..:80/../escaped",
+	} {
+		if _, err := saveFile(u, []byte(u), false, defaultLogger()); err != nil {
+			t.Errorf("saveFile(%q): %s", u, err)
+		}
+	}
+
+	// Nothing may have been written beside the save directory
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.Name() != "save" {
+			t.Errorf("%q was saved outside of the save directory", e.Name())
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package fetcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxEnqueueBody is the largest body POST /enqueue reads
+const maxEnqueueBody = 16 << 20
+
+// server accepts requests to fetch over HTTP, for the serve subcommand, and
+// writes them as input lines to the scanner
+type server struct {
+	f       *Fetcher // Whose input the requests are queued to
+	lock    sync.Mutex
+	input   *io.PipeWriter
+	started time.Time
+	http    *http.Server
+}
+
+// serve starts serving POST /enqueue and GET /stats at the address, returning
+// the input the enqueued requests are read from
+func (f *Fetcher) serve(addr string) (io.ReadCloser, error) {
+	r, w := io.Pipe()
+	mux := http.NewServeMux()
+	s := &server{f: f, input: w, started: time.Now(), http: &http.Server{Handler: mux}}
+	mux.HandleFunc("/enqueue", s.enqueue)
+	mux.HandleFunc("/stats", s.stats)
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %s", addr, err)
+	}
+	if f.GRPCListen != "" {
+		if err = f.serveGRPC(s, f.GRPCListen); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	f.enqueuer = s
+	go func() {
+		f.Logger.Debug("serving", "addr", addr)
+		if err := s.http.Serve(l); err != nil && err != http.ErrServerClosed {
+			f.Logger.Error("could not serve", "error", err)
+		}
+	}()
+	return r, nil
+}
+
+// enqueue handles POST /enqueue, whose body is a JSON request object (as with
+// -input json), a JSON array of them or of URLs, or lines of URLs. It responds
+// once they're all queued, so a full queue pushes back on the client
+func (s *server) enqueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST requests to enqueue", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEnqueueBody))
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reqs, err := parseEnqueue(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = s.queue(reqs...); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"queued": len(reqs)})
+}
+
+// queue writes the requests to the input, blocking while the queue is full
+func (s *server) queue(reqs ...getRequest) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, req := range reqs {
+		if _, err := fmt.Fprintln(s.input, s.f.formatLine(&req)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueued returns the getRequest of an enqueued request. Clients may not name
+// local files to upload, which would let anyone who can reach the server
+// upload any file it can read to anywhere
+func enqueued(jr jsonRequest) (getRequest, error) {
+	if !strings.Contains(jr.URL, "://") {
+		return getRequest{}, fmt.Errorf("invalid URL '%s'", jr.URL)
+	}
+	if jr.File != "" {
+		return getRequest{}, fmt.Errorf("files to upload can't be enqueued")
+	}
+	req := getRequest{
+		URL:         jr.URL,
+		Expect:      jr.Expect,
+		Method:      strings.ToUpper(jr.Method),
+		ContentType: jr.ContentType,
+		Session:     jr.Session,
+		Priority:    jr.Priority,
+	}
+	if jr.Body != "" {
+		req.Body = []byte(jr.Body)
+	}
+	return req, nil
+}
+
+// parseEnqueue returns the requests of an enqueue body
+func parseEnqueue(body []byte) ([]getRequest, error) {
+	var reqs []getRequest
+	add := func(jr jsonRequest) error {
+		req, err := enqueued(jr)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+		return nil
+	}
+
+	body = bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(body, []byte("{")):
+		var jr jsonRequest
+		if err := json.Unmarshal(body, &jr); err != nil {
+			return nil, err
+		}
+		return reqs, add(jr)
+	case bytes.HasPrefix(body, []byte("[")):
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			var jr jsonRequest
+			if err := json.Unmarshal(item, &jr.URL); err != nil {
+				if err := json.Unmarshal(item, &jr); err != nil {
+					return nil, err
+				}
+			}
+			if err := add(jr); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				if err := add(jsonRequest{URL: line}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return reqs, nil
+}
+
+// stats handles GET /stats, responding with the stats so far, as -stats-json
+func (s *server) stats(w http.ResponseWriter, r *http.Request) {
+	// The record is encoded while the live stat is locked, so none of it
+	// can change underneath, and written once the lock is let go
+	s.f.liveLock.Lock()
+	b, err := json.MarshalIndent(s.f.record(s.f.live, time.Since(s.started)), "", "  ")
+	s.f.liveLock.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// Close stops accepting requests, so the run ends once those queued are done
+func (s *server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.input.Close()
+}
+
+// closeServe stops the HTTP server, if serving, giving the requests being
+// handled a few seconds to finish
+func (f *Fetcher) closeServe() {
+	if f.enqueuer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.enqueuer.http.Shutdown(ctx); err != nil {
+		f.enqueuer.http.Close()
+	}
+}
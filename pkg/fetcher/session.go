@@ -0,0 +1,78 @@
+package fetcher
+
+import (
+	"golang.org/x/net/publicsuffix"
+
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/http/cookiejar"
+)
+
+// sessionAgents are the User-Agents given to -sessions, in turn
+var sessionAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+}
+
+// session is a simulated user, with its own cookies and User-Agent
+type session struct {
+	jar   http.CookieJar
+	agent string
+}
+
+// newSessions returns n sessions, each with its own cookie jar,
+// and the sessionAgents in turn
+func newSessions(n int) ([]*session, error) {
+	s := make([]*session, n)
+	for i := range s {
+		jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		if err != nil {
+			return nil, err
+		}
+		s[i] = &session{
+			jar:   jar,
+			agent: fmt.Sprintf("%s wgetpipe-session/%d", sessionAgents[i%len(sessionAgents)], i+1),
+		}
+	}
+	return s, nil
+}
+
+// sessionFor returns the session the request is consistently assigned to, by
+// the hash of its Session tag if it has one, else of its URL, or nil if there
+// are no sessions
+func (f *Fetcher) sessionFor(req *getRequest) *session {
+	if len(f.sessions) == 0 {
+		return nil
+	}
+	key := req.Session
+	if key == "" {
+		key = req.URL
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return f.sessions[h.Sum32()%uint32(len(f.sessions))]
+}
+
+// use sets the client to use the session's cookie jar, and the RoundTripper
+// wrapped to send the session's User-Agent
+func (s *session) use(c *http.Client, rt http.RoundTripper) {
+	c.Jar = s.jar
+	c.Transport = &agentTransport{rt: rt, agent: s.agent}
+}
+
+// agentTransport is an http.RoundTripper that sets the User-Agent of requests
+type agentTransport struct {
+	rt    http.RoundTripper
+	agent string
+}
+
+// RoundTrip sets the User-Agent of a clone of the request, and round-trips it
+func (t *agentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.agent)
+	return t.rt.RoundTrip(req)
+}
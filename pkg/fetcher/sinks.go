@@ -0,0 +1,105 @@
+package fetcher
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// resultSinks are the files that collate writes the URLs of results to
+type resultSinks struct {
+	Failed *os.File // Unsuccessful URLs, appended (-failed)
+	OK     *os.File // Successful URLs (-ok-file)
+	Err    *os.File // Unsuccessful URLs (-err-file)
+	State  *os.File // Completed URLs, appended (-state)
+
+	log *slog.Logger // Where diagnostics are logged
+}
+
+// openSinks opens the FailedFile, OKFile, ErrFile, and StateFile, as set
+func (f *Fetcher) openSinks() (*resultSinks, error) {
+	var (
+		s   = resultSinks{log: f.Logger}
+		err error
+	)
+	if f.FailedFile != "" {
+		if s.Failed, err = os.OpenFile(f.FailedFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			return nil, fmt.Errorf("-failed: %w", err)
+		}
+	}
+	if f.OKFile != "" {
+		if s.OK, err = os.Create(f.OKFile); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("-ok-file: %w", err)
+		}
+	}
+	if f.ErrFile != "" {
+		if s.Err, err = os.Create(f.ErrFile); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("-err-file: %w", err)
+		}
+	}
+	if f.StateFile != "" {
+		if s.State, err = os.OpenFile(f.StateFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("-state: %w", err)
+		}
+	}
+	return &s, nil
+}
+
+// write writes the result's URL to the sinks for its outcome
+func (s *resultSinks) write(i *urlCode) {
+	if s == nil {
+		return
+	}
+	if i.Code != 0 {
+		// Got a response, so it needn't be gotten again
+		sinkURL(s.State, i.URL, s.log)
+	}
+	if i.ok() {
+		sinkURL(s.OK, i.URL, s.log)
+	} else {
+		sinkURL(s.Failed, i.URL, s.log)
+		sinkURL(s.Err, i.URL, s.log)
+	}
+}
+
+// Close closes the sinks
+func (s *resultSinks) Close() {
+	for _, f := range []*os.File{s.Failed, s.OK, s.Err, s.State} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// sinkURL writes the URL as a line to the sink, if it is set
+func sinkURL(f *os.File, u string, log *slog.Logger) {
+	if f == nil {
+		return
+	}
+	if _, err := fmt.Fprintln(f, u); err != nil {
+		log.Error("could not write", "path", f.Name(), "error", err)
+	}
+}
+
+// loadState returns the set of URLs completed by previous runs, from the
+// StateFile, which need not exist yet
+func loadState(file string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		done[scanner.Text()] = true
+	}
+	return done, scanner.Err()
+}
@@ -0,0 +1,89 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// errAborted is returned when work is stopped due to an abort
+var errAborted = errors.New("aborted")
+
+// sitemap is a sitemap urlset, or sitemap index
+type sitemap struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// sitemapLoc is a url or sitemap entry in a sitemap
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// scanSitemap fetches the sitemap at the URL, and sends every URL in it to the
+// sender, recursing into any sitemaps if it is a sitemap index. seen is
+// the set of sitemaps already scanned, to prevent loops
+func (f *Fetcher) scanSitemap(u string, seen map[string]bool, s *sender) error {
+	if seen[u] {
+		return nil
+	}
+	seen[u] = true
+
+	sm, err := f.fetchSitemap(u)
+	if err != nil {
+		return err
+	}
+	f.Logger.Debug("read sitemap", "url", u, "urls", len(sm.URLs), "sitemaps", len(sm.Sitemaps))
+
+	for _, l := range sm.URLs {
+		if loc := strings.TrimSpace(l.Loc); loc != "" {
+			if !s.send(getRequest{URL: loc}) {
+				return errAborted
+			}
+		}
+	}
+	for _, l := range sm.Sitemaps {
+		if loc := strings.TrimSpace(l.Loc); loc != "" {
+			if err := f.scanSitemap(loc, seen, s); err == errAborted {
+				return err
+			} else if err != nil {
+				f.Logger.Error("could not read sitemap", "url", loc, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchSitemap fetches and parses the sitemap at the URL, gunzipping it if need be
+func (f *Fetcher) fetchSitemap(u string) (*sitemap, error) {
+	c := &http.Client{Transport: f.Transport, Timeout: f.Timeout, CheckRedirect: f.checkRedirect}
+	response, err := c.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP %d", response.StatusCode)
+	}
+
+	var r io.Reader = bufio.NewReader(response.Body)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var sm sitemap
+	if err := xml.NewDecoder(r).Decode(&sm); err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
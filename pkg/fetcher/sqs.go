@@ -0,0 +1,99 @@
+package fetcher
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// sqsQueue is a queueSource of input lines from the bodies of SQS messages.
+// Messages are deleted once their request succeeds, and otherwise left to
+// become visible again, so the queue's redrive policy applies
+type sqsQueue struct {
+	f        *Fetcher // Whose InputFormat the messages are in
+	client   *sqs.Client
+	url      string
+	received []types.Message // Received, but not yet returned by next
+}
+
+// newSQSQueue returns an sqsQueue of the queue URL, configured from the
+// environment (credentials, AWS_REGION, AWS_ENDPOINT_URL_SQS, etc.)
+func newSQSQueue(f *Fetcher, queueURL string) (*sqsQueue, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = sqsRegion(queueURL)
+	}
+	return &sqsQueue{f: f, client: sqs.NewFromConfig(cfg), url: queueURL}, nil
+}
+
+// sqsRegion returns the region of an SQS queue URL, e.g. us-east-1 of
+// https://sqs.us-east-1.amazonaws.com/123456789012/name, or ""
+func sqsRegion(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(u.Hostname(), ".")
+	if len(parts) >= 4 && parts[0] == "sqs" {
+		return parts[1]
+	}
+	return ""
+}
+
+// next returns the next request from the queue, long-polling for them
+func (q *sqsQueue) next(ctx context.Context) (getRequest, error) {
+	for {
+		if len(q.received) == 0 {
+			out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+				QueueUrl:            aws.String(q.url),
+				MaxNumberOfMessages: 10,
+				WaitTimeSeconds:     20,
+			})
+			if err != nil {
+				return getRequest{}, err
+			}
+			q.received = out.Messages
+			continue
+		}
+		msg := q.received[0]
+		q.received = q.received[1:]
+
+		line := strings.TrimSpace(aws.ToString(msg.Body))
+		req, err := q.f.parseLine(line)
+		if err == nil && line == "" {
+			err = errors.New("empty message")
+		}
+		if err != nil {
+			// Left for the redrive policy to deal with
+			q.f.Logger.Debug("scanner skipping queued message", "id", aws.ToString(msg.MessageId), "error", err)
+			continue
+		}
+		req.Ack = func(ok bool) {
+			if !ok {
+				return
+			}
+			_, err := q.client.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(q.url),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+			if err != nil {
+				q.f.Logger.Error("could not delete SQS message", "id", aws.ToString(msg.MessageId), "error", err)
+			}
+		}
+		return req, nil
+	}
+}
+
+// Close does nothing, as there is no connection to close
+func (q *sqsQueue) Close() error {
+	return nil
+}
@@ -0,0 +1,212 @@
+package fetcher
+
+import (
+	"github.com/cognusion/go-humanity"
+
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sparkWidth is the number of recent latencies kept per host for sparklines
+const sparkWidth = 40
+
+// sparkTicks are the characters used to draw sparklines, low to high
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// hostStat holds the per-host tallies of the collated responses
+type hostStat struct {
+	Count         int             // Results
+	Errors        int             // Results that weren't ok
+	Bytes         int64           // Response sizes
+	Latency       histogram       // Latencies of the responses
+	Recent        []time.Duration // The most recent latencies, oldest first
+	TLSHandshakes int             // TLS handshakes done
+	TLSResumed    int             // TLS handshakes that resumed a previous session
+}
+
+// add tallies the response into the hostStat
+func (h *hostStat) add(i *urlCode) {
+	h.Count++
+	if !i.ok() {
+		h.Errors++
+	}
+	if i.Size > 0 {
+		h.Bytes += i.Size
+	}
+	if i.Code != 0 {
+		h.Latency.add(i.Dur)
+	}
+	if i.TLSHandshake {
+		h.TLSHandshakes++
+		if i.TLSResumed {
+			h.TLSResumed++
+		}
+	}
+	h.Recent = append(h.Recent, i.Dur)
+	if len(h.Recent) > sparkWidth {
+		h.Recent = h.Recent[len(h.Recent)-sparkWidth:]
+	}
+}
+
+// host returns the hostStat for the URL's host, creating it if need be
+func (s *stat) host(u string) *hostStat {
+	host := "unknown"
+	if pu, err := url.Parse(u); err == nil && pu.Host != "" {
+		host = pu.Host
+	}
+
+	if s.Hosts == nil {
+		s.Hosts = make(map[string]*hostStat)
+	}
+	h, ok := s.Hosts[host]
+	if !ok {
+		h = &hostStat{}
+		s.Hosts[host] = h
+	}
+	return h
+}
+
+// hostNames returns the names of the hosts, sorted
+func (s *stat) hostNames() []string {
+	names := make([]string, 0, len(s.Hosts))
+	for name := range s.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printSparklines outputs a sparkline of the recent latencies of each host
+func (s *stat) printSparklines() {
+	fmt.Println("Latency by Host:")
+	for _, name := range s.hostNames() {
+		h := s.Hosts[name]
+		min, max := minMax(h.Recent)
+		fmt.Printf("  %s %s (%s - %s)\n", name, sparkline(h.Recent), min, max)
+	}
+}
+
+// printHosts outputs a table of the tallies of each host
+func (s *stat) printHosts() {
+	fmt.Println("By Host:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  HOST\tCOUNT\tERRORS\tBYTES\tMEAN\tP50\tP90\tP99\tMAX")
+	for _, name := range s.hostNames() {
+		h := s.Hosts[name]
+		l := &h.Latency
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", name, h.Count, h.Errors, humanity.ByteFormat(h.Bytes),
+			l.mean(), l.percentile(50), l.percentile(90), l.percentile(99), l.Max)
+	}
+	w.Flush()
+}
+
+// printTLSResumption outputs the TLS session resumption rate of each host
+// that had TLS handshakes
+func (s *stat) printTLSResumption() {
+	fmt.Println("TLS Resumption by Host:")
+	for _, name := range s.hostNames() {
+		h := s.Hosts[name]
+		if h.TLSHandshakes == 0 {
+			continue
+		}
+		fmt.Printf("  %s %d/%d (%.1f%%)\n", name, h.TLSResumed, h.TLSHandshakes, 100*float64(h.TLSResumed)/float64(h.TLSHandshakes))
+	}
+}
+
+// latency tallies the response's latency, overall and by status class
+func (s *stat) latency(i *urlCode) {
+	s.Latency.add(i.Dur)
+	if s.Classes == nil {
+		s.Classes = make(map[string]*histogram)
+	}
+	class := statusClass(i)
+	if s.Classes[class] == nil {
+		s.Classes[class] = &histogram{}
+	}
+	s.Classes[class].add(i.Dur)
+}
+
+// slow keeps the response if it's one of the top slowest
+func (s *stat) slow(i *urlCode, top int) {
+	if top <= 0 || (len(s.Slowest) == top && i.Dur <= s.Slowest[top-1].Dur) {
+		return
+	}
+	n := sort.Search(len(s.Slowest), func(n int) bool { return s.Slowest[n].Dur < i.Dur })
+	s.Slowest = append(s.Slowest, urlCode{})
+	copy(s.Slowest[n+1:], s.Slowest[n:])
+	s.Slowest[n] = *i
+	if len(s.Slowest) > top {
+		s.Slowest = s.Slowest[:top]
+	}
+}
+
+// printSlowest outputs the slowest responses, slowest first
+func (s *stat) printSlowest() {
+	fmt.Printf("Slowest %d:\n", len(s.Slowest))
+	for _, i := range s.Slowest {
+		fmt.Printf("  %s (%s) %d %s\n", i.Dur, humanity.ByteFormat(i.Size), i.Code, displayURL(i.URL))
+	}
+}
+
+// printCodes outputs the number of responses with each status code
+func (s *stat) printCodes() {
+	codes := make([]int, 0, len(s.Codes))
+	for code := range s.Codes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	fmt.Println("Status Codes:")
+	for _, code := range codes {
+		fmt.Printf("  %d: %d\n", code, s.Codes[code])
+	}
+}
+
+// printLatencies outputs the latency percentiles, overall and by status class
+func (s *stat) printLatencies() {
+	fmt.Printf("Latency: %s\n", s.Latency.percentiles())
+	classes := make([]string, 0, len(s.Classes))
+	for class := range s.Classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Printf("  %s (%d): %s\n", class, s.Classes[class].Count, s.Classes[class].percentiles())
+	}
+}
+
+// minMax returns the smallest and largest of the durations
+func minMax(ds []time.Duration) (time.Duration, time.Duration) {
+	if len(ds) == 0 {
+		return 0, 0
+	}
+	min, max := ds[0], ds[0]
+	for _, d := range ds[1:] {
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return min, max
+}
+
+// sparkline returns a sparkline of the durations, scaled between their min and max
+func sparkline(ds []time.Duration) string {
+	min, max := minMax(ds)
+
+	var b strings.Builder
+	for _, d := range ds {
+		t := 0
+		if max > min {
+			t = int(int64(d-min) * int64(len(sparkTicks)-1) / int64(max-min))
+		}
+		b.WriteRune(sparkTicks[t])
+	}
+	return b.String()
+}
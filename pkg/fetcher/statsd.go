@@ -0,0 +1,72 @@
+package fetcher
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	neturl "net/url"
+	"strings"
+)
+
+// statsdClient sends DogStatsD-tagged metrics over UDP, if -statsd is set
+type statsdClient struct {
+	conn   net.Conn
+	prefix string
+	log    *slog.Logger // Where diagnostics are logged
+}
+
+// newStatsdClient returns a statsdClient sending to the host:port, with the
+// metric names prefixed
+func newStatsdClient(addr, prefix string, log *slog.Logger) (*statsdClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &statsdClient{conn: conn, prefix: prefix, log: log}, nil
+}
+
+// send sends a metric of the type ("c", "ms", ...) with the tags. Metrics are
+// best-effort, so errors are only debugged
+func (s *statsdClient) send(name, value, typ string, tags []string) {
+	m := fmt.Sprintf("%s%s:%s|%s", s.prefix, name, value, typ)
+	if len(tags) > 0 {
+		m += "|#" + strings.Join(tags, ",")
+	}
+	if _, err := s.conn.Write([]byte(m)); err != nil {
+		s.log.Debug("could not send statsd metric", "metric", m, "error", err)
+	}
+}
+
+// result sends the metrics of the result: a "requests" counter, and for
+// responses, a "response_time" timing and "bytes" counter, tagged by host
+// and status class
+func (s *statsdClient) result(i *urlCode) {
+	host := "unknown"
+	if u, err := neturl.Parse(i.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	tags := []string{"host:" + host, "status:" + statusClass(i)}
+
+	s.send("requests", "1", "c", tags)
+	if i.Code != 0 {
+		s.send("response_time", fmt.Sprintf("%.3f", ms(i.Dur)), "ms", tags)
+		s.send("bytes", fmt.Sprint(i.Size), "c", tags)
+	}
+}
+
+// statusClass returns the status class of the result, e.g. "2xx", or "error"
+// if there was no response
+func statusClass(i *urlCode) string {
+	if i.Code == 0 {
+		return "error"
+	}
+	return fmt.Sprintf("%dxx", i.Code/100)
+}
+
+// Close closes the connection
+func (s *statsdClient) Close() error {
+	return s.conn.Close()
+}
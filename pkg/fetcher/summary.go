@@ -0,0 +1,175 @@
+package fetcher
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// summaryLatencies are the latencies of the responses, in milliseconds
+type summaryLatencies struct {
+	Min float64 `json:"min"`
+	Avg float64 `json:"avg"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// summaryHost is the tallies of a host, for -stats-by-host
+type summaryHost struct {
+	Count   int              `json:"count"`
+	Errors  int              `json:"errors"`
+	Bytes   int64            `json:"bytes"`
+	Latency summaryLatencies `json:"latency_ms"`
+}
+
+// summaryRecord is the machine-readable form of the summary, for -stats-json
+// and -stats-file
+type summaryRecord struct {
+	Partial     bool        `json:"partial"` // Aborted, so only the responses received are counted
+	Gets        int         `json:"gets"`
+	Errors      int         `json:"errors"`
+	Failures    int         `json:"failures"`
+	Mismatches  int         `json:"mismatches"`
+	Error4s     int         `json:"4xx"`
+	Error5s     int         `json:"5xx"`
+	Redirects   int         `json:"redirect_loops_chains"`
+	Aborted     int         `json:"aborted"`
+	Skipped     int         `json:"skipped"`
+	Unchanged   int         `json:"unchanged"`
+	Deduped     int         `json:"etag_deduped"`
+	NotModified int         `json:"not_modified"`
+	Cached      int         `json:"cached"`
+	Duplicates  int64       `json:"duplicates"`
+	Filtered    int64       `json:"filtered"`
+	Completed   int64       `json:"previously_completed"`
+	Invalid     int64       `json:"invalid_lines"`
+	Codes       map[int]int `json:"codes,omitempty"`
+	ElapsedMS   float64     `json:"elapsed_ms"`
+	PerSecond   float64     `json:"gets_per_second"`
+	Bytes       int64       `json:"body_bytes"`
+	BytesPerS   float64     `json:"body_bytes_per_second"`
+	WireBytes   int64       `json:"wire_bytes,omitempty"`     // Encoded bytes of the bodies decoded by -compress
+	CASStored   int64       `json:"cas_stored,omitempty"`     // Bodies stored by -save-cas
+	CASDups     int64       `json:"cas_duplicates,omitempty"` // Bodies -save-cas already had
+	NotSaved    int         `json:"not_saved,omitempty"`      // Bodies not saved, with -max-disk reached
+
+	Latency        summaryLatencies            `json:"latency_ms"`
+	LatencyByClass map[string]summaryLatencies `json:"latency_by_class_ms"`
+
+	Hosts   map[string]summaryHost `json:"hosts,omitempty"`   // If -stats-by-host
+	Slowest []Result               `json:"slowest,omitempty"` // If -top
+
+	DNSLookups    int64   `json:"dns_lookups"`
+	DNSCacheHits  int64   `json:"dns_cache_hits"`
+	Connections   int64   `json:"connections"`
+	TLSHandshakes int64   `json:"tls_handshakes"`
+	TLSResumed    int64   `json:"tls_resumed"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	BytesPerSec   float64 `json:"bytes_received_per_second"`
+}
+
+// record returns the summaryRecord of the run, which took elapsed
+func (f *Fetcher) record(st *stat, elapsed time.Duration) summaryRecord {
+	r := summaryRecord{
+		Partial:     st.Partial,
+		Gets:        st.Count,
+		Errors:      st.Errors,
+		Failures:    st.Failures,
+		Mismatches:  st.Mismatches,
+		Error4s:     st.Error4s,
+		Error5s:     st.Error5s,
+		Redirects:   st.Redirects,
+		Aborted:     st.Aborted,
+		Skipped:     st.Skipped,
+		Unchanged:   st.Unchanged,
+		Deduped:     st.Deduped,
+		NotModified: st.NotModified,
+		Cached:      st.Cached,
+		NotSaved:    st.NotSaved,
+		Duplicates:  atomic.LoadInt64(&f.inputStats.Duplicates),
+		Filtered:    atomic.LoadInt64(&f.inputStats.Filtered),
+		Completed:   atomic.LoadInt64(&f.inputStats.Completed),
+		Invalid:     atomic.LoadInt64(&f.inputStats.Invalid),
+		Bytes:       st.Bytes,
+		WireBytes:   st.WireBytes,
+		ElapsedMS:   ms(elapsed),
+
+		DNSLookups:    atomic.LoadInt64(&f.netStats.DNSLookups),
+		DNSCacheHits:  atomic.LoadInt64(&f.netStats.DNSCacheHits),
+		Connections:   atomic.LoadInt64(&f.netStats.Connections),
+		TLSHandshakes: atomic.LoadInt64(&f.netStats.TLSHandshakes),
+		TLSResumed:    atomic.LoadInt64(&f.netStats.TLSResumed),
+		BytesSent:     atomic.LoadInt64(&f.netStats.BytesSent),
+		BytesReceived: atomic.LoadInt64(&f.netStats.BytesReceived),
+	}
+	if cas, ok := f.saver.(*casSaver); ok {
+		r.CASStored, r.CASDups = atomic.LoadInt64(&cas.stored), atomic.LoadInt64(&cas.duplicates)
+	}
+	if s := elapsed.Seconds(); s > 0 {
+		r.PerSecond = float64(st.Count) / s
+		r.BytesPerS = float64(st.Bytes) / s
+		r.BytesPerSec = float64(r.BytesReceived) / s
+	}
+	// The Codes are copied, as the live stat keeps counting into its map
+	// after the record is made
+	r.Codes = make(map[int]int, len(st.Codes))
+	for code, n := range st.Codes {
+		r.Codes[code] = n
+	}
+	r.Latency = latencies(&st.Latency)
+	r.LatencyByClass = make(map[string]summaryLatencies, len(st.Classes))
+	for class, h := range st.Classes {
+		r.LatencyByClass[class] = latencies(h)
+	}
+	for n := range st.Slowest {
+		r.Slowest = append(r.Slowest, f.newRecord(&st.Slowest[n], nil))
+	}
+	if f.StatsByHost {
+		r.Hosts = make(map[string]summaryHost, len(st.Hosts))
+		for name, h := range st.Hosts {
+			r.Hosts[name] = summaryHost{Count: h.Count, Errors: h.Errors, Bytes: h.Bytes, Latency: latencies(&h.Latency)}
+		}
+	}
+	return r
+}
+
+// latencies returns the summaryLatencies of the histogram
+func latencies(h *histogram) summaryLatencies {
+	if h.Count == 0 {
+		return summaryLatencies{}
+	}
+	return summaryLatencies{
+		Min: ms(h.Min),
+		Avg: ms(h.mean()),
+		P50: ms(h.percentile(50)),
+		P90: ms(h.percentile(90)),
+		P99: ms(h.percentile(99)),
+		Max: ms(h.Max),
+	}
+}
+
+// writeJSON writes the summaryRecord of the run, which took elapsed, to w
+func (f *Fetcher) writeJSON(st *stat, w io.Writer, elapsed time.Duration) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f.record(st, elapsed))
+}
+
+// writeJSONFile writes the summaryRecord of the run, which took elapsed,
+// to the file
+func (f *Fetcher) writeJSONFile(st *stat, file string, elapsed time.Duration) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := f.writeJSON(st, out, elapsed); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
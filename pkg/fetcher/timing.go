@@ -0,0 +1,157 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// phaseTimings are the durations of the phases of a request, zero for
+// phases that didn't happen (e.g. on a reused connection)
+type phaseTimings struct {
+	DNS      time.Duration // Resolving the hostname
+	Connect  time.Duration // Establishing the TCP connection
+	TLS      time.Duration // The TLS handshake
+	TTFB     time.Duration // From the request being sent to the first response byte
+	Transfer time.Duration // From the first response byte to the end of the body, if it was read
+}
+
+// reqTiming holds the timings of the phases of a request
+type reqTiming struct {
+	lock         sync.Mutex
+	phases       phaseTimings
+	dnsStart     time.Time     // When the hostname resolution started
+	connectStart time.Time     // When the connection started
+	connectDone  time.Time     // When the connection (to the proxy, if any) was established
+	tlsStart     time.Time     // When the TLS handshake started
+	wrote        time.Time     // When the request was sent
+	firstByte    time.Time     // When the first response byte arrived
+	tunnel       time.Duration // Time to establish a CONNECT tunnel through the proxy
+	handshake    bool          // Whether a TLS handshake was done, rather than reusing a connection
+	resumed      bool          // Whether the TLS handshake resumed a previous session
+}
+
+// timingKey is the context key for a *reqTiming
+type timingKey struct{}
+
+// withTiming returns a context that records the timings of a request made with
+// it into the returned reqTiming
+func withTiming(ctx context.Context) (context.Context, *reqTiming) {
+	t := &reqTiming{}
+	ctx = context.WithValue(ctx, timingKey{}, t)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.lock.Lock()
+			t.dnsStart = time.Now()
+			t.lock.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.lock.Lock()
+			t.phases.DNS = time.Since(t.dnsStart)
+			t.lock.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			t.lock.Lock()
+			t.connectStart = time.Now()
+			t.lock.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.lock.Lock()
+				t.connectDone = time.Now()
+				t.phases.Connect = t.connectDone.Sub(t.connectStart)
+				t.lock.Unlock()
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.lock.Lock()
+			t.tlsStart = time.Now()
+			t.lock.Unlock()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			if err == nil {
+				t.lock.Lock()
+				t.handshake = true
+				t.resumed = cs.DidResume
+				t.phases.TLS = time.Since(t.tlsStart)
+				t.lock.Unlock()
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.lock.Lock()
+			t.wrote = time.Now()
+			t.lock.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.lock.Lock()
+			t.firstByte = time.Now()
+			if !t.wrote.IsZero() {
+				t.phases.TTFB = t.firstByte.Sub(t.wrote)
+			}
+			t.lock.Unlock()
+		},
+	})
+	return ctx, t
+}
+
+// timingFrom returns the reqTiming from the context, or nil
+func timingFrom(ctx context.Context) *reqTiming {
+	t, _ := ctx.Value(timingKey{}).(*reqTiming)
+	return t
+}
+
+// tunnelled records that a CONNECT tunnel was established
+func (t *reqTiming) tunnelled() {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.connectDone.IsZero() {
+		t.tunnel = time.Since(t.connectDone)
+	}
+}
+
+// Tunnel returns the time taken to establish a CONNECT tunnel, if one was
+func (t *reqTiming) Tunnel() time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.tunnel
+}
+
+// Handshake returns whether a TLS handshake was done, and if so, whether
+// it resumed a previous session
+func (t *reqTiming) Handshake() (bool, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.handshake, t.resumed
+}
+
+// resolved records the time taken to resolve the hostname, when it was
+// resolved outside of the trace (e.g. by the dnsCache)
+func (t *reqTiming) resolved(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.phases.DNS = d
+}
+
+// bodyRead records that the response body has been read
+func (t *reqTiming) bodyRead() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.firstByte.IsZero() {
+		t.phases.Transfer = time.Since(t.firstByte)
+	}
+}
+
+// Phases returns the durations of the phases of the request
+func (t *reqTiming) Phases() phaseTimings {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.phases
+}
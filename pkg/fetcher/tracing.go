@@ -0,0 +1,177 @@
+package fetcher
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// initTracing sets up the exporting of spans to the OTLP/HTTP endpoint, which
+// may be a plaintext host:port (e.g. a local collector), or a URL
+func (f *Fetcher) initTracing(endpoint string) error {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	if !strings.Contains(endpoint, "://") {
+		opts = []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+	}
+	exp, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", "wgetpipe")))
+	if err != nil {
+		return err
+	}
+
+	f.tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	f.tracer = f.tracerProvider.Tracer("github.com/cognusion/wgetpipe")
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return nil
+}
+
+// closeTracing exports any remaining spans, if tracing
+func (f *Fetcher) closeTracing() {
+	if f.tracerProvider == nil {
+		return
+	}
+	if err := f.tracerProvider.Shutdown(context.Background()); err != nil {
+		f.Logger.Error("could not export spans", "error", err)
+	}
+}
+
+// startSpan returns a context with a new span for the request, whose DNS,
+// connect, and TLS phases are recorded as child spans, if tracing
+func (f *Fetcher) startSpan(ctx context.Context, req *getRequest) (context.Context, trace.Span) {
+	if f.tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	method := req.Method
+	if method == "" {
+		method = f.Method
+	}
+	ctx, span := f.tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", req.URL),
+	))
+	return httptrace.WithClientTrace(ctx, f.phaseSpans(ctx)), span
+}
+
+// endSpan records the result on the span, and ends it
+func endSpan(span trace.Span, uc *urlCode) {
+	if uc.Code != 0 {
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", uc.Code),
+			attribute.Int64("http.response.body.size", uc.Size),
+		)
+	}
+	switch {
+	case uc.Err != nil:
+		span.RecordError(uc.Err)
+		span.SetStatus(codes.Error, uc.Err.Error())
+	case uc.Fail != nil:
+		span.SetStatus(codes.Error, uc.Fail.Error())
+	case !uc.ok():
+		span.SetStatus(codes.Error, http.StatusText(uc.Code))
+	}
+	span.End()
+}
+
+// phaseSpans returns a ClientTrace that records the DNS, connect, and TLS
+// phases of the request as child spans of the context's
+func (f *Fetcher) phaseSpans(ctx context.Context) *httptrace.ClientTrace {
+	var (
+		lock             sync.Mutex
+		dnsSpan, tlsSpan trace.Span
+		connects         = make(map[string]trace.Span) // By address, as they may race
+	)
+	end := func(span trace.Span, err error) {
+		if span == nil {
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			lock.Lock()
+			defer lock.Unlock()
+			_, dnsSpan = f.tracer.Start(ctx, "dns", trace.WithAttributes(attribute.String("server.address", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			lock.Lock()
+			defer lock.Unlock()
+			end(dnsSpan, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			lock.Lock()
+			defer lock.Unlock()
+			_, connects[addr] = f.tracer.Start(ctx, "connect", trace.WithAttributes(
+				attribute.String("network.transport", network),
+				attribute.String("network.peer.address", addr),
+			))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			end(connects[addr], err)
+			delete(connects, addr)
+		},
+		TLSHandshakeStart: func() {
+			lock.Lock()
+			defer lock.Unlock()
+			_, tlsSpan = f.tracer.Start(ctx, "tls")
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			if tlsSpan != nil {
+				tlsSpan.SetAttributes(attribute.Bool("tls.resumed", cs.DidResume))
+			}
+			end(tlsSpan, err)
+		},
+	}
+}
+
+// resolvedSpan records a hostname resolution done outside of the ClientTrace
+// (e.g. by the dnsCache) that started at the time, as a child span
+func (f *Fetcher) resolvedSpan(ctx context.Context, host string, start time.Time, err error) {
+	if f.tracer == nil {
+		return
+	}
+	_, span := f.tracer.Start(ctx, "dns", trace.WithTimestamp(start), trace.WithAttributes(attribute.String("server.address", host)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceTransport is an http.RoundTripper that sends the W3C traceparent of
+// the request's span, so server-side spans join it
+type traceTransport struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip injects the trace context into a clone of the request, and
+// round-trips it
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return t.rt.RoundTrip(req)
+}
@@ -0,0 +1,201 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// accounting tallies the network resources used over a run
+type accounting struct {
+	DNSLookups    int64 // Hostname resolutions performed
+	DNSCacheHits  int64 // Hostnames already in the dnsCache
+	Connections   int64 // Connections opened
+	TLSHandshakes int64 // TLS handshakes completed
+	TLSResumed    int64 // TLS handshakes that resumed a previous session
+	BytesSent     int64 // Bytes written to connections
+	BytesReceived int64 // Bytes read from connections
+}
+
+// trace returns an httptrace.ClientTrace to tally per-request events
+func (a *accounting) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			if err == nil {
+				atomic.AddInt64(&a.TLSHandshakes, 1)
+				if cs.DidResume {
+					atomic.AddInt64(&a.TLSResumed, 1)
+				}
+			}
+		},
+	}
+}
+
+// countingConn is a net.Conn that tallies the bytes read and written
+type countingConn struct {
+	net.Conn
+	stats *accounting
+}
+
+// Read tallies the bytes read into the stats
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.stats.BytesReceived, int64(n))
+	return n, err
+}
+
+// Write tallies the bytes written into the stats
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.stats.BytesSent, int64(n))
+	return n, err
+}
+
+// newTransport returns an http.RoundTripper that uses the dnsCache (if enabled),
+// the ProxyURL (if set), and a TLS session cache of TLSSessionCache (if non-zero),
+// within the ConnectTimeout and TTFBTimeout, and tallies its network resource
+// use into netStats
+func (f *Fetcher) newTransport() http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   f.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 64
+	if f.ConnectTimeout > 0 && f.ConnectTimeout < t.TLSHandshakeTimeout {
+		// Establishing the connection includes its handshake
+		t.TLSHandshakeTimeout = f.ConnectTimeout
+	}
+	t.ResponseHeaderTimeout = f.TTFBTimeout
+	if f.TLSSessionCache > 0 {
+		t.TLSClientConfig = &tls.Config{ClientSessionCache: tls.NewLRUClientSessionCache(f.TLSSessionCache)}
+	}
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) == nil {
+			if f.dnsCache == nil {
+				atomic.AddInt64(&f.netStats.DNSLookups, 1)
+			} else {
+				if _, ok := f.dnsCached.Load(host); !ok {
+					atomic.AddInt64(&f.netStats.DNSLookups, 1)
+				} else {
+					atomic.AddInt64(&f.netStats.DNSCacheHits, 1)
+				}
+				s := time.Now()
+				ip, err := f.dnsCache.FetchOneString(host)
+				f.resolvedSpan(ctx, host, s, err)
+				if err != nil {
+					return nil, err
+				}
+				timingFrom(ctx).resolved(time.Since(s))
+				f.dnsCached.Store(host, true)
+				address = net.JoinHostPort(ip, port)
+			}
+		}
+
+		d := dialer
+		if la := f.localAddr(address); la != nil {
+			ld := *dialer
+			ld.LocalAddr = la
+			d = &ld
+		}
+		conn, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&f.netStats.Connections, 1)
+		return &countingConn{conn, &f.netStats}, nil
+	}
+
+	t.RegisterProtocol(unixScheme, &unixTransport{f: f, base: t.Clone()})
+	if f.FileURLs {
+		// file:// URLs are read from the local filesystem, as an
+		// http.FileServer of / would serve them
+		t.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	}
+	// ftp:// and ftps:// URLs are fetched over FTP, dialling as HTTP would
+	ftp := &ftpTransport{dial: t.DialContext, sessions: tls.NewLRUClientSessionCache(0)}
+	t.RegisterProtocol("ftp", ftp)
+	t.RegisterProtocol("ftps", ftp)
+	// s3:// URLs are S3 API calls, dialling as HTTP would
+	s3 := &s3Transport{dial: t.DialContext}
+	t.RegisterProtocol("s3", s3)
+	if f.s3 == nil {
+		// The first transport's, made by Configure, also makes -put's
+		// uploads to s3:// URLs
+		f.s3 = s3
+	}
+	if f.UnixSocket != "" {
+		// Everything goes to the socket, whatever the URL's host
+		t.DialContext = f.unixDialer(f.UnixSocket)
+		t.Proxy = nil
+		return t
+	}
+
+	if f.ProxyURL != nil {
+		return setProxy(t, f.ProxyURL, f.Logger)
+	}
+	return t
+}
+
+// localAddr returns the next of the LocalAddrs to dial the address from,
+// round-robin, skipping those of the other IP family if the address is an
+// IP. It returns nil if there are none to use
+func (f *Fetcher) localAddr(address string) net.Addr {
+	if len(f.localAddrs) == 0 {
+		return nil
+	}
+	var v4 *bool
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			is4 := ip.To4() != nil
+			v4 = &is4
+		}
+	}
+	for range f.localAddrs {
+		la := f.localAddrs[int(atomic.AddUint64(&f.localNext, 1)-1)%len(f.localAddrs)]
+		if v4 == nil || (la.IP.To4() != nil) == *v4 {
+			return la
+		}
+	}
+	return nil
+}
+
+// localResponse returns a response made up for the request, by a transport
+// for some other protocol, with the status code, and the message as its
+// body, if any
+func localResponse(req *http.Request, proto string, code int, message string) *http.Response {
+	response := &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Proto:      proto,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	if message != "" {
+		response.Body = io.NopCloser(strings.NewReader(message + "\n"))
+		response.ContentLength = int64(len(message) + 1)
+		response.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	return response
+}
+
+// crossSchemeRedirect returns true if the request follows a redirect from
+// another scheme, which the transports of schemes that read local files or use
+// our credentials refuse, whatever the client's CheckRedirect allowed
+func crossSchemeRedirect(req *http.Request) bool {
+	return req.Response != nil && req.Response.Request != nil && req.Response.Request.URL.Scheme != req.URL.Scheme
+}
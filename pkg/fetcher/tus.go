@@ -0,0 +1,205 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// tusVersion is the tus.io resumable upload protocol version we speak
+const tusVersion = "1.0.0"
+
+// uploadCheckpoints maps uploads (endpoint and file) to the tus upload URLs
+// created for them, persisted to a file so interrupted uploads can resume
+type uploadCheckpoints struct {
+	lock    sync.Mutex
+	file    string
+	uploads map[string]string
+	log     *slog.Logger // Where diagnostics are logged
+}
+
+// loadCheckpoints returns the upload checkpoints from the file, which need
+// not exist yet
+func loadCheckpoints(file string, log *slog.Logger) (*uploadCheckpoints, error) {
+	c := &uploadCheckpoints{file: file, uploads: make(map[string]string), log: log}
+	b, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.uploads); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file '%s': %w", file, err)
+	}
+	return c, nil
+}
+
+// get returns the upload URL checkpointed for the key, if any
+func (c *uploadCheckpoints) get(key string) string {
+	if c == nil {
+		return ""
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.uploads[key]
+}
+
+// set checkpoints the upload URL for the key, or removes the checkpoint
+// if the URL is empty, and persists the checkpoints
+func (c *uploadCheckpoints) set(key, location string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if location == "" {
+		delete(c.uploads, key)
+	} else {
+		c.uploads[key] = location
+	}
+
+	b, err := json.MarshalIndent(c.uploads, "", "  ")
+	if err != nil {
+		c.log.Error("could not encode upload checkpoints", "error", err)
+		return
+	}
+	tmp := c.file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		c.log.Error("could not write upload checkpoints", "error", err)
+		return
+	}
+	if err := os.Rename(tmp, c.file); err != nil {
+		c.log.Error("could not write upload checkpoints", "error", err)
+	}
+}
+
+// tusUpload takes a context, client, and getRequest, and uploads the
+// getRequest's File to its URL as a tus.io endpoint, in ChunkSize PATCHes,
+// resuming any checkpointed upload of it. It returns the last response, and
+// the number of bytes uploaded by this call
+func (f *Fetcher) tusUpload(ctx context.Context, c *http.Client, req *getRequest) (*http.Response, int64, error) {
+	file, err := os.Open(req.File)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	size := fi.Size()
+	key := req.URL + "\t" + req.File
+
+	// Resume from the server's offset if we have a checkpoint
+	var offset int64
+	location := f.checkpoints.get(key)
+	if location != "" {
+		if offset, err = tusOffset(ctx, c, location); err != nil {
+			f.Logger.Debug("not resuming upload", "file", req.File, "url", location, "error", err)
+			location = ""
+		} else {
+			f.Logger.Debug("resuming upload", "file", req.File, "url", location, "offset", offset)
+		}
+	}
+
+	var response *http.Response
+	if location == "" {
+		hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		hreq.Header.Set("Tus-Resumable", tusVersion)
+		hreq.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+		hreq.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filepath.Base(req.File))))
+		response, err = c.Do(hreq)
+		if err != nil {
+			return nil, 0, err
+		}
+		if response.StatusCode != http.StatusCreated {
+			return response, 0, nil
+		}
+		loc, err := response.Location()
+		if err != nil {
+			response.Body.Close()
+			return nil, 0, fmt.Errorf("tus creation gave no upload URL: %w", err)
+		}
+		location = loc.String()
+		f.checkpoints.set(key, location)
+	}
+
+	var uploaded int64
+	for offset < size {
+		if response != nil {
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, uploaded, err
+		}
+
+		n := min(f.ChunkSize, size-offset)
+		hreq, err := http.NewRequestWithContext(ctx, http.MethodPatch, location, io.NewSectionReader(file, offset, n))
+		if err != nil {
+			return nil, uploaded, err
+		}
+		hreq.ContentLength = n
+		hreq.Header.Set("Tus-Resumable", tusVersion)
+		hreq.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		hreq.Header.Set("Content-Type", "application/offset+octet-stream")
+
+		response, err = c.Do(hreq)
+		if err != nil {
+			return nil, uploaded, err
+		}
+		if response.StatusCode != http.StatusNoContent {
+			return response, uploaded, nil
+		}
+		next, err := strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil || next <= offset {
+			response.Body.Close()
+			return nil, uploaded, fmt.Errorf("tus PATCH gave bad Upload-Offset '%s'", response.Header.Get("Upload-Offset"))
+		}
+		uploaded += next - offset
+		offset = next
+	}
+	f.checkpoints.set(key, "")
+
+	if response == nil {
+		// Resumed an already-complete upload, so there is nothing to return but its state
+		return tusHead(ctx, c, location)
+	}
+	return response, uploaded, nil
+}
+
+// tusHead returns the response to a tus HEAD of the upload URL
+func tusHead(ctx context.Context, c *http.Client, location string) (*http.Response, int64, error) {
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodHead, location, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	hreq.Header.Set("Tus-Resumable", tusVersion)
+	response, err := c.Do(hreq)
+	return response, 0, err
+}
+
+// tusOffset returns the offset the server has for the upload URL
+func tusOffset(ctx context.Context, c *http.Client, location string) (int64, error) {
+	response, _, err := tusHead(ctx, c, location)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("HEAD got %d", response.StatusCode)
+	}
+	return strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+}
@@ -0,0 +1,122 @@
+package fetcher
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// unfetchedList collects the requests not completed because of an abort,
+// for -unfetched
+type unfetchedList struct {
+	f    *Fetcher // Whose InputFormat the lines are in
+	lock sync.Mutex
+	reqs []getRequest
+}
+
+// add adds the request to the list, if there is one
+func (u *unfetchedList) add(req getRequest) {
+	if u == nil {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.reqs = append(u.reqs, req)
+}
+
+// drain adds the requests still queued in getChan, the priorityQueue,
+// and the crawler's queue
+func (u *unfetchedList) drain(getChan chan getRequest, prio *priorityQueue) {
+	if u == nil {
+		return
+	}
+	for _, req := range prio.drain() {
+		u.add(req)
+	}
+	for {
+		select {
+		case req, ok := <-getChan:
+			if !ok {
+				return
+			}
+			if req.URL != "" {
+				u.add(req)
+			}
+		default:
+			for _, req := range u.f.frontier.unqueue() {
+				u.add(req)
+			}
+			return
+		}
+	}
+}
+
+// write writes the requests to the file as input lines, per the
+// InputFormat, so the run can be resumed from it
+func (u *unfetchedList) write(file string) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	for _, req := range u.reqs {
+		if _, err := fmt.Fprintln(f, u.f.formatLine(&req)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// formatLine returns the request as a line of input, per the InputFormat,
+// such that parseLine would return it
+func (f *Fetcher) formatLine(req *getRequest) string {
+	if f.InputFormat == "json" {
+		b, _ := json.Marshal(jsonRequest{
+			URL:         req.URL,
+			Expect:      req.Expect,
+			Method:      req.Method,
+			Body:        string(req.Body),
+			ContentType: req.ContentType,
+			File:        req.File,
+			Session:     req.Session,
+			Priority:    req.Priority,
+		})
+		return string(b)
+	}
+	if f.InputFormat == "csv" || f.InputFormat == "tsv" {
+		row := make([]string, f.URLColumn)
+		row[f.URLColumn-1] = req.URL
+		for n, c := range f.CarryColumns {
+			for len(row) < c.Index {
+				row = append(row, "")
+			}
+			if n < len(req.Carried) {
+				row[c.Index-1] = req.Carried[n]
+			}
+		}
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		if f.InputFormat == "tsv" {
+			w.Comma = '\t'
+		}
+		w.Write(row)
+		w.Flush()
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+
+	line := req.URL
+	if f.PutMode {
+		line += "\t" + req.File
+	}
+	if req.Expect != 0 {
+		line += "\t" + strconv.Itoa(req.Expect)
+	}
+	return line
+}
@@ -0,0 +1,90 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// unixScheme is the URL scheme of requests to a Unix socket, whose path is
+// the socket's path and the request's, separated by a colon, e.g.
+// http+unix:///run/app.sock:/health
+const unixScheme = "http+unix"
+
+// unixTransport is an http.RoundTripper for http+unix URLs, registered with
+// the transport. Each socket gets a transport of its own, so that their
+// connections aren't pooled together
+type unixTransport struct {
+	f          *Fetcher
+	base       *http.Transport // Cloned for each socket
+	transports sync.Map        // *http.Transport by socket path
+}
+
+// RoundTrip makes the request over the socket in its path, as an http
+// request to localhost
+func (u *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	socket, path, ok := strings.Cut(req.URL.Path, ":")
+	if !ok || socket == "" {
+		return nil, fmt.Errorf("no Unix socket in '%s', as in http+unix:///run/app.sock:/path", req.URL)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	rt, ok := u.transports.Load(socket)
+	if !ok {
+		rt, _ = u.transports.LoadOrStore(socket, u.f.unixSocketTransport(u.base, socket))
+	}
+
+	hreq := req.Clone(req.Context())
+	hreq.URL.Scheme = "http"
+	hreq.URL.Host = "localhost"
+	hreq.URL.Path = path
+	hreq.URL.RawPath = ""
+	hreq.Host = "localhost"
+	response, err := rt.(*http.Transport).RoundTrip(hreq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Redirects within the server stay on the socket
+	if loc := response.Header.Get("Location"); loc != "" {
+		if lu, err := hreq.URL.Parse(loc); err == nil && lu.Scheme == "http" && lu.Host == "localhost" {
+			response.Header.Set("Location", unixScheme+"://"+socket+":"+lu.RequestURI())
+		}
+	}
+	response.Request = req
+	return response, nil
+}
+
+// unixSocketTransport returns a clone of the transport that dials the socket
+// for every connection, tallying it into netStats
+func (f *Fetcher) unixSocketTransport(t *http.Transport, socket string) *http.Transport {
+	t = t.Clone()
+	t.Proxy = nil
+	t.DialContext = f.unixDialer(socket)
+	return t
+}
+
+// unixDialer returns a DialContext function that dials the socket, whatever
+// the address
+func (f *Fetcher) unixDialer(socket string) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var d net.Dialer
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if f.ConnectTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, f.ConnectTimeout)
+			defer cancel()
+		}
+		conn, err := d.DialContext(ctx, "unix", socket)
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&f.netStats.Connections, 1)
+		return &countingConn{conn, &f.netStats}, nil
+	}
+}
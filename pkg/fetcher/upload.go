@@ -0,0 +1,156 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// uploadFile takes a context, client, method, and getRequest, and uploads the
+// getRequest's File as the body of the request, returning the response and the
+// number of bytes uploaded
+func (f *Fetcher) uploadFile(ctx context.Context, c *http.Client, method string, req *getRequest) (*http.Response, int64, error) {
+	file, err := os.Open(req.File)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, method, req.URL, file)
+	if err != nil {
+		return nil, 0, err
+	}
+	hreq.ContentLength = fi.Size()
+	hreq.GetBody = func() (io.ReadCloser, error) {
+		return os.Open(req.File)
+	}
+
+	hreq.Header.Set("Content-Type", f.uploadContentType(req))
+
+	response, err := c.Do(hreq)
+	return response, fi.Size(), err
+}
+
+// uploadContentType returns the Content-Type to upload the getRequest's File
+// as: its own, else the default, else that of the file's extension
+func (f *Fetcher) uploadContentType(req *getRequest) string {
+	ct := req.ContentType
+	if ct == "" {
+		ct = f.ContentType
+	}
+	if ct == "" {
+		ct = mime.TypeByExtension(filepath.Ext(req.File))
+	}
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	return ct
+}
+
+// verifyUpload takes a context, client, the getRequest of an upload, and its
+// response, and verifies per VerifyUpload that the uploaded content matches the
+// local file, returning a VERIFY-FAILED error if it does not
+func (f *Fetcher) verifyUpload(ctx context.Context, c *http.Client, req *getRequest, response *http.Response) error {
+	h := response.Header
+	u := req.URL
+	if response.Request != nil {
+		// Where it actually ended up, e.g. a tus upload URL
+		u = response.Request.URL.String()
+	}
+	if f.VerifyUpload == "head" || f.VerifyUpload == "get" {
+		method := http.MethodHead
+		if f.VerifyUpload == "get" {
+			method = http.MethodGet
+		}
+		vreq, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			return fmt.Errorf("VERIFY-FAILED: %w", err)
+		}
+		vresp, err := c.Do(vreq)
+		if err != nil {
+			return fmt.Errorf("VERIFY-FAILED: %w", err)
+		}
+		defer vresp.Body.Close()
+		if vresp.StatusCode >= 400 {
+			return fmt.Errorf("VERIFY-FAILED: %s got %d", method, vresp.StatusCode)
+		}
+
+		if method == http.MethodGet {
+			remote := sha256.New()
+			if _, err := io.Copy(remote, vresp.Body); err != nil {
+				return fmt.Errorf("VERIFY-FAILED: %w", err)
+			}
+			local, err := hashFile(req.File, sha256.New)
+			if err != nil {
+				return fmt.Errorf("VERIFY-FAILED: %w", err)
+			}
+			if !bytes.Equal(local, remote.Sum(nil)) {
+				return fmt.Errorf("VERIFY-FAILED: content differs")
+			}
+			return nil
+		}
+		h = vresp.Header
+	}
+
+	// Compare the MD5 from the headers
+	local, err := hashFile(req.File, md5.New)
+	if err != nil {
+		return fmt.Errorf("VERIFY-FAILED: %w", err)
+	}
+	if cmd5 := h.Get("Content-MD5"); cmd5 != "" {
+		if cmd5 != base64.StdEncoding.EncodeToString(local) {
+			return fmt.Errorf("VERIFY-FAILED: Content-MD5 %s differs", cmd5)
+		}
+		return nil
+	}
+	if etag := h.Get("ETag"); etag != "" {
+		want := hex.EncodeToString(local)
+		tag := strings.Trim(strings.TrimPrefix(etag, "W/"), `"`)
+		if strings.Contains(tag, "-") {
+			// The ETag of an S3 multipart upload, which isn't of the whole file
+			fi, err := os.Stat(req.File)
+			if err != nil {
+				return fmt.Errorf("VERIFY-FAILED: %w", err)
+			}
+			if want, err = multipartETag(req.File, f.s3PartSize(fi.Size())); err != nil {
+				return fmt.Errorf("VERIFY-FAILED: %w", err)
+			}
+		}
+		if tag != want {
+			return fmt.Errorf("VERIFY-FAILED: ETag %s differs", etag)
+		}
+		return nil
+	}
+	return fmt.Errorf("VERIFY-FAILED: no ETag or Content-MD5 to verify")
+}
+
+// hashFile returns the hash of the named file, using the hash constructor
+func hashFile(file string, newHash func() hash.Hash) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}